@@ -0,0 +1,174 @@
+// Command xconnect-dlq inspects, replays and purges RabbitMQ dead-letter queues.
+//
+// Usage:
+//
+//	xconnect-dlq [-url amqp://...] peek -queue orders.dlq [-n 10]
+//	xconnect-dlq [-url amqp://...] replay -queue orders.dlq [-limit 0] [-id a,b] [-exchange x] [-routing-key k]
+//	xconnect-dlq [-url amqp://...] purge -queue orders.dlq -force
+//
+// The broker URL defaults to the RABBITMQ_URL environment variable.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/eugene-ruby/xconnect/rabbitmq"
+	"github.com/eugene-ruby/xconnect/rabbitmq/dlq"
+)
+
+func main() {
+	log.SetFlags(0)
+	os.Exit(cli(os.Args[1:]))
+}
+
+// cli connects to the broker, runs the command given in args and returns the
+// exit code, so that the connection is closed before the process exits.
+func cli(args []string) int {
+	fs := flag.NewFlagSet("xconnect-dlq", flag.ExitOnError)
+	url := fs.String("url", os.Getenv("RABBITMQ_URL"), "broker URL")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: xconnect-dlq [-url amqp://...] peek|replay|purge -queue NAME [flags]")
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 || *url == "" {
+		fs.Usage()
+		return 2
+	}
+
+	conn, err := rabbitmq.Dial(*url, rabbitmq.ConnectionConfig{})
+	if err != nil {
+		log.Printf("xconnect-dlq: %v", err)
+		return 1
+	}
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		log.Printf("xconnect-dlq: %v", err)
+		return 1
+	}
+
+	if err := run(ch, os.Stdout, fs.Arg(0), fs.Args()[1:]); err != nil {
+		log.Printf("xconnect-dlq: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// run executes the named command with its arguments on ch.
+func run(ch rabbitmq.Channel, out io.Writer, command string, args []string) error {
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	queue := fs.String("queue", "", "dead-letter queue name")
+
+	switch command {
+	case "peek":
+		n := fs.Int("n", 10, "number of messages to show")
+		if err := parse(fs, args); err != nil {
+			return err
+		}
+		return peek(ch, out, *queue, *n)
+
+	case "replay":
+		limit := fs.Int("limit", 0, "maximum number of messages to replay, 0 for all")
+		ids := fs.String("id", "", "comma-separated message IDs to replay, empty for all")
+		exchange := fs.String("exchange", "", "publish to this exchange instead of the original one")
+		routingKey := fs.String("routing-key", "", "publish with this routing key instead of the original one")
+		if err := parse(fs, args); err != nil {
+			return err
+		}
+		return replay(ch, out, *queue, *limit, *ids, *exchange, *routingKey)
+
+	case "purge":
+		force := fs.Bool("force", false, "confirm that every message should be deleted")
+		if err := parse(fs, args); err != nil {
+			return err
+		}
+		if !*force {
+			return errors.New("purge deletes every message, pass -force to confirm")
+		}
+		n, err := dlq.Purge(ch, *queue)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "purged %d messages from %s\n", n, *queue)
+		return nil
+
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// parse parses args into fs and checks that -queue was set.
+func parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.Lookup("queue").Value.String() == "" {
+		return errors.New("-queue is required")
+	}
+	return nil
+}
+
+func peek(ch rabbitmq.Channel, out io.Writer, queue string, n int) error {
+	msgs, err := dlq.Peek(ch, queue, n)
+	if err != nil {
+		return err
+	}
+	for i, m := range msgs {
+		exchange, routingKey, originErr := m.Origin()
+		origin := fmt.Sprintf("%q / %q", exchange, routingKey)
+		if originErr != nil {
+			origin = "unknown"
+		}
+		fmt.Fprintf(out, "#%d message-id=%q origin=%s\n", i+1, m.MessageID, origin)
+		for _, d := range m.Deaths {
+			fmt.Fprintf(out, "    x-death queue=%s reason=%s count=%d exchange=%q routing-keys=%v time=%s\n",
+				d.Queue, d.Reason, d.Count, d.Exchange, d.RoutingKeys, d.Time.Format("2006-01-02T15:04:05Z07:00"))
+		}
+		if reason, ok := m.Headers[rabbitmq.RetryErrorHeader].(string); ok {
+			fmt.Fprintf(out, "    last error: %s\n", reason)
+		}
+		fmt.Fprintf(out, "    body: %s\n", truncate(m.Body, 200))
+	}
+	fmt.Fprintf(out, "%d messages shown\n", len(msgs))
+	return nil
+}
+
+func replay(ch rabbitmq.Channel, out io.Writer, queue string, limit int, ids, exchange, routingKey string) error {
+	opts := dlq.ReplayOptions{Limit: limit}
+	if ids != "" {
+		selected := make(map[string]bool)
+		for _, id := range strings.Split(ids, ",") {
+			selected[strings.TrimSpace(id)] = true
+		}
+		opts.Filter = func(m dlq.Message) bool { return selected[m.MessageID] }
+	}
+	if exchange != "" || routingKey != "" {
+		opts.Rewrite = func(m dlq.Message, req *rabbitmq.PublishRequest) {
+			if exchange != "" {
+				req.Exchange = exchange
+			}
+			if routingKey != "" {
+				req.RoutingKey = routingKey
+			}
+		}
+	}
+
+	result, err := dlq.Replay(ch, queue, opts)
+	fmt.Fprintf(out, "replayed %d messages, skipped %d in %s\n", result.Replayed, result.Skipped, queue)
+	return err
+}
+
+func truncate(body []byte, n int) string {
+	if len(body) <= n {
+		return string(body)
+	}
+	return string(body[:n]) + "..."
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/eugene-ruby/xconnect/rabbitmq"
+	"github.com/eugene-ruby/xconnect/rabbitmq/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func parkedMessages() map[string][]rabbitmq.Delivery {
+	return map[string][]rabbitmq.Delivery{
+		"orders.dlq": {
+			{MessageID: "a", Headers: rabbitmq.Table{rabbitmq.RetryQueueHeader: "orders", rabbitmq.RetryErrorHeader: "boom"}, Body: []byte("first")},
+			{MessageID: "b", Headers: rabbitmq.Table{rabbitmq.RetryQueueHeader: "orders"}, Body: []byte("second")},
+		},
+	}
+}
+
+func TestRun_Peek(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	mock.GetMessages = parkedMessages()
+
+	var out bytes.Buffer
+	require.NoError(t, run(mock, &out, "peek", []string{"-queue", "orders.dlq", "-n", "1"}))
+
+	require.Contains(t, out.String(), `message-id="a" origin="" / "orders"`)
+	require.Contains(t, out.String(), "last error: boom")
+	require.Contains(t, out.String(), "1 messages shown")
+}
+
+func TestRun_ReplaySelected(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	mock.ConfirmFunc = func(mocks.PublishedMessage) bool { return true }
+	mock.GetMessages = parkedMessages()
+
+	var out bytes.Buffer
+	require.NoError(t, run(mock, &out, "replay", []string{"-queue", "orders.dlq", "-id", "b", "-routing-key", "orders.v2"}))
+
+	require.Len(t, mock.PublishedMessages, 1)
+	require.Equal(t, "orders.v2", mock.PublishedMessages[0].RoutingKey)
+	require.Equal(t, "replayed 1 messages, skipped 1 in orders.dlq\n", out.String())
+}
+
+func TestRun_PurgeRequiresForce(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	mock.GetMessages = parkedMessages()
+
+	var out bytes.Buffer
+	require.Error(t, run(mock, &out, "purge", []string{"-queue", "orders.dlq"}))
+	require.NoError(t, run(mock, &out, "purge", []string{"-queue", "orders.dlq", "-force"}))
+	require.Equal(t, "purged 2 messages from orders.dlq\n", out.String())
+
+	require.Error(t, run(mock, &out, "peek", nil))
+	require.Error(t, run(mock, &out, "unknown", nil))
+}
+
+func TestCLI_UsageWithoutURL(t *testing.T) {
+	t.Setenv("RABBITMQ_URL", "")
+	require.Equal(t, 2, cli([]string{"peek", "-queue", "orders.dlq"}))
+}
@@ -0,0 +1,39 @@
+// Package table normalizes decoded YAML and JSON values into the types AMQP
+// tables accept.
+package table
+
+import "encoding/json"
+
+// Normalize converts the values of t in place: ints and integral json.Numbers
+// become int64, other json.Numbers float64, and nested maps become T.
+func Normalize[T ~map[string]interface{}](t T) T {
+	for k, v := range t {
+		t[k] = normalizeValue[T](v)
+	}
+	return t
+}
+
+func normalizeValue[T ~map[string]interface{}](v interface{}) interface{} {
+	switch val := v.(type) {
+	case int:
+		return int64(val)
+	case json.Number:
+		if n, err := val.Int64(); err == nil {
+			return n
+		}
+		if f, err := val.Float64(); err == nil {
+			return f
+		}
+		return val.String()
+	case T:
+		return Normalize(val)
+	case map[string]interface{}:
+		return Normalize(T(val))
+	case []interface{}:
+		for i, item := range val {
+			val[i] = normalizeValue[T](item)
+		}
+		return val
+	}
+	return v
+}
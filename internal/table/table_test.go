@@ -0,0 +1,28 @@
+package table_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/eugene-ruby/xconnect/internal/table"
+	"github.com/eugene-ruby/xconnect/rabbitmq"
+)
+
+func TestNormalize(t *testing.T) {
+	got := table.Normalize(rabbitmq.Table{
+		"int":    1,
+		"number": json.Number("2"),
+		"float":  json.Number("0.5"),
+		"nested": map[string]interface{}{"count": json.Number("3")},
+		"list":   []interface{}{rabbitmq.Table{"n": 4}, "a"},
+	})
+	require.Equal(t, rabbitmq.Table{
+		"int":    int64(1),
+		"number": int64(2),
+		"float":  0.5,
+		"nested": rabbitmq.Table{"count": int64(3)},
+		"list":   []interface{}{rabbitmq.Table{"n": int64(4)}, "a"},
+	}, got)
+}
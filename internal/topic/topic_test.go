@@ -0,0 +1,29 @@
+package topic_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/eugene-ruby/xconnect/internal/topic"
+)
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		pattern, key string
+		want         bool
+	}{
+		{"order.created", "order.created", true},
+		{"order.*", "order.created", true},
+		{"order.*", "order.eu.created", false},
+		{"order.#", "order", true},
+		{"order.#", "order.eu.created", true},
+		{"#.created", "order.eu.created", true},
+		{"#", "", true},
+		{"*", "", true},
+		{"order.*.paid", "order.eu.created", false},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.want, topic.Match(c.pattern, c.key), "%q against %q", c.key, c.pattern)
+	}
+}
@@ -0,0 +1,57 @@
+package rabbitmq
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Default bounds used when a Backoff leaves Min or Max unset.
+const (
+	DefaultMinBackoff = 500 * time.Millisecond
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// Backoff computes jittered exponential delays between retry attempts.
+type Backoff struct {
+	Min time.Duration // delay before the first retry, defaults to DefaultMinBackoff
+	Max time.Duration // upper bound for any delay, defaults to DefaultMaxBackoff
+}
+
+// Duration returns the delay before the given 1-based attempt. The delay
+// doubles with every attempt up to Max, and a random half of it is jitter so
+// that many clients do not retry in lockstep.
+func (b Backoff) Duration(attempt int) time.Duration {
+	lo, hi := b.Min, b.Max
+	if lo <= 0 {
+		lo = DefaultMinBackoff
+	}
+	if hi <= 0 {
+		hi = DefaultMaxBackoff
+	}
+	if hi < lo {
+		hi = lo
+	}
+
+	delay := lo
+	for i := 1; i < attempt && delay < hi; i++ {
+		delay *= 2
+	}
+	if delay > hi {
+		delay = hi
+	}
+
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+// sleep waits for d or until done is closed. It reports whether d elapsed.
+func sleep(d time.Duration, done <-chan struct{}) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
@@ -1,15 +1,31 @@
 // Package rabbitmq provides abstractions and wrappers for messaging with RabbitMQ.
 package rabbitmq
 
+import "context"
+
 // Channel defines an abstract message channel interface.
 
 // Channel abstracts a message broker channel.
 type Channel interface {
 	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args Table) error
+	ExchangeDelete(name string, ifUnused, noWait bool) error
 	Publish(exchange, routingKey string, body []byte) error
+	PublishWithOptions(exchange, routingKey string, mandatory, immediate bool, msg Publishing) error
+	PublishWithContext(ctx context.Context, exchange, routingKey string, mandatory, immediate bool, msg Publishing) error
+	Confirm(noWait bool) error
+	NotifyPublish(confirm chan Confirmation) chan Confirmation
+	NotifyReturn(c chan Return) chan Return
 	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args Table) (Queue, error)
 	QueueBind(name, key, exchange string, noWait bool, args Table) error
+	QueueUnbind(name, key, exchange string, args Table) error
+	QueueInspect(name string) (Queue, error)
+	QueueDelete(name string, ifUnused, ifEmpty, noWait bool) (int, error)
+	ExchangeBind(destination, key, source string, noWait bool, args Table) error
+	ExchangeUnbind(destination, key, source string, noWait bool, args Table) error
+	QueuePurge(name string, noWait bool) (int, error)
+	Qos(prefetchCount, prefetchSize int, global bool) error
 	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args Table) (<-chan Delivery, error)
+	Get(queue string, autoAck bool) (msg Delivery, ok bool, err error)
 	Cancel(consumer string, noWait bool) error
 	Close() error
 }
@@ -20,3 +36,10 @@ type Queue struct {
 	Messages  int
 	Consumers int
 }
+
+// Confirmation is a broker acknowledgement of a publish made in confirm mode.
+type Confirmation struct {
+	DeliveryTag uint64 // 1-based counter of publishes since Confirm was called
+	Ack         bool   // true when the broker accepted the message
+	Multiple    bool   // true when the confirmation covers every tag up to DeliveryTag
+}
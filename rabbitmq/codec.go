@@ -0,0 +1,82 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+)
+
+// Content types of the codecs in this package and the conventional protobuf one.
+const (
+	JSONContentType     = "application/json"
+	ProtobufContentType = "application/x-protobuf"
+)
+
+// ErrDecode is wrapped by the errors TypedWorker returns for messages it cannot decode.
+var ErrDecode = errors.New("rabbitmq: cannot decode message")
+
+// Codec converts between values and message bodies of one content type.
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSON is the Codec for JSON bodies.
+var JSON Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string                        { return JSONContentType }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// NewCodec builds a Codec from marshal and unmarshal functions, for example
+// to plug in protobuf without this package depending on it:
+//
+//	codec := rabbitmq.NewCodec(rabbitmq.ProtobufContentType,
+//		func(v any) ([]byte, error) { return proto.Marshal(v.(proto.Message)) },
+//		func(b []byte, v any) error { return proto.Unmarshal(b, v.(proto.Message)) })
+func NewCodec(contentType string, marshal func(v interface{}) ([]byte, error), unmarshal func(data []byte, v interface{}) error) Codec {
+	return funcCodec{contentType: contentType, marshal: marshal, unmarshal: unmarshal}
+}
+
+type funcCodec struct {
+	contentType string
+	marshal     func(v interface{}) ([]byte, error)
+	unmarshal   func(data []byte, v interface{}) error
+}
+
+func (c funcCodec) ContentType() string                        { return c.contentType }
+func (c funcCodec) Marshal(v interface{}) ([]byte, error)      { return c.marshal(v) }
+func (c funcCodec) Unmarshal(data []byte, v interface{}) error { return c.unmarshal(data, v) }
+
+// decode unmarshals the body of d with codec into a new T. Deliveries whose
+// media type differs from the codec's are refused; parameters such as charset
+// are ignored, and an empty content type is accepted for publishers that do
+// not set one.
+func decode[T any](codec Codec, d Delivery) (T, error) {
+	var v T
+	if d.ContentType != "" && !sameMediaType(d.ContentType, codec.ContentType()) {
+		return v, fmt.Errorf("%w: content type %q, want %q", ErrDecode, d.ContentType, codec.ContentType())
+	}
+	if err := codec.Unmarshal(d.Body, &v); err != nil {
+		return v, fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+	return v, nil
+}
+
+// sameMediaType reports whether two content types name the same media type,
+// ignoring parameters and case.
+func sameMediaType(a, b string) bool {
+	ma, _, err := mime.ParseMediaType(a)
+	if err != nil {
+		return false
+	}
+	mb, _, err := mime.ParseMediaType(b)
+	if err != nil {
+		return false
+	}
+	return ma == mb
+}
@@ -0,0 +1,398 @@
+package rabbitmq
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNacked is returned when the broker negatively acknowledges a publish.
+	ErrNacked = errors.New("rabbitmq: message nacked by broker")
+	// ErrConfirmTimeout is returned when no confirmation arrives in time.
+	ErrConfirmTimeout = errors.New("rabbitmq: timed out waiting for publisher confirm")
+	// ErrConfirmsClosed is returned when the channel stops delivering confirmations.
+	ErrConfirmsClosed = errors.New("rabbitmq: publisher confirms closed")
+)
+
+// DefaultMaxInFlight bounds unconfirmed publishes when ConfirmConfig.MaxInFlight is zero.
+const DefaultMaxInFlight = 256
+
+// ConfirmError describes a publish that was not confirmed by the broker.
+type ConfirmError struct {
+	DeliveryTag uint64
+	Exchange    string
+	RoutingKey  string
+	Err         error
+
+	// Return holds the returned message when Err wraps ErrUnroutable.
+	Return *Return
+}
+
+func (e *ConfirmError) Error() string {
+	return fmt.Sprintf("rabbitmq: publish %d to exchange %q with key %q: %v", e.DeliveryTag, e.Exchange, e.RoutingKey, e.Err)
+}
+
+func (e *ConfirmError) Unwrap() error { return e.Err }
+
+// ConfirmConfig holds configuration for a ConfirmPublisher.
+type ConfirmConfig struct {
+	// Timeout bounds how long Publish waits for a confirmation. Zero waits until ctx is done.
+	Timeout time.Duration
+	// MaxInFlight bounds the number of unconfirmed publishes. PublishAsync blocks
+	// while the limit is reached. Defaults to DefaultMaxInFlight.
+	MaxInFlight int
+	// Mandatory publishes every message with the mandatory flag. Mandatory
+	// publishes the broker returns fail with ErrUnroutable. A return is matched
+	// to the oldest unconfirmed mandatory publish with the same exchange,
+	// routing key and body.
+	Mandatory bool
+}
+
+// ConfirmPublisher publishes in confirm mode. Publish waits for the broker to
+// confirm each message, PublishAsync pipelines publishes and returns a
+// DeferredConfirmation per message.
+type ConfirmPublisher struct {
+	pub    *Publisher
+	config ConfirmConfig
+
+	publishMu sync.Mutex // serializes publishes so delivery tags follow publish order
+	nextTag   uint64
+	inFlight  chan struct{}
+
+	mu      sync.Mutex
+	pending []*DeferredConfirmation // unconfirmed publishes in delivery tag order
+	closed  bool
+}
+
+// DeferredConfirmation is the pending broker confirmation of one publish.
+type DeferredConfirmation struct {
+	tag        uint64
+	exchange   string
+	routingKey string
+	mandatory  bool
+	body       []byte // matched against returned messages
+	done       chan struct{}
+	err        error
+	returned   *Return
+	release    func()
+	once       sync.Once
+}
+
+// NewConfirmPublisher puts ch into confirm mode and returns a publisher that
+// tracks broker confirmations.
+func NewConfirmPublisher(ch Channel, config ConfirmConfig) (*ConfirmPublisher, error) {
+	if config.MaxInFlight <= 0 {
+		config.MaxInFlight = DefaultMaxInFlight
+	}
+	if err := ch.Confirm(false); err != nil {
+		return nil, fmt.Errorf("publisher: enable confirm mode: %w", err)
+	}
+
+	p := &ConfirmPublisher{
+		pub:      NewPublisher(ch),
+		config:   config,
+		inFlight: make(chan struct{}, config.MaxInFlight),
+	}
+	confirms := ch.NotifyPublish(make(chan Confirmation, config.MaxInFlight))
+	returns := ch.NotifyReturn(make(chan Return, config.MaxInFlight))
+	go p.listen(confirms, returns)
+	return p, nil
+}
+
+// Publish sends a message and blocks until the broker confirms it.
+func (p *ConfirmPublisher) Publish(ctx context.Context, exchange, routingKey string, body []byte) error {
+	return p.PublishWithOptions(ctx, exchange, routingKey, false, false, Publishing{
+		ContentType: "application/octet-stream",
+		Body:        body,
+	})
+}
+
+// PublishWithOptions sends a message with explicit properties and blocks until
+// the broker confirms it. A nack, a returned mandatory publish or a missing
+// confirmation is reported as a *ConfirmError.
+func (p *ConfirmPublisher) PublishWithOptions(ctx context.Context, exchange, routingKey string, mandatory, immediate bool, msg Publishing) error {
+	dc, err := p.PublishAsync(ctx, exchange, routingKey, mandatory, immediate, msg)
+	if err != nil {
+		return err
+	}
+
+	if p.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.config.Timeout)
+		defer cancel()
+	}
+	if err := dc.Wait(ctx); err != nil {
+		return p.forget(dc, err)
+	}
+	return nil
+}
+
+// PublishAsync sends a message without waiting for its confirmation. It blocks
+// only while MaxInFlight publishes are unconfirmed.
+func (p *ConfirmPublisher) PublishAsync(ctx context.Context, exchange, routingKey string, mandatory, immediate bool, msg Publishing) (*DeferredConfirmation, error) {
+	select {
+	case p.inFlight <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	release := func() { <-p.inFlight }
+
+	p.publishMu.Lock()
+	defer p.publishMu.Unlock()
+
+	dc := &DeferredConfirmation{
+		tag:        p.nextTag + 1,
+		exchange:   exchange,
+		routingKey: routingKey,
+		done:       make(chan struct{}),
+		release:    release,
+	}
+
+	if mandatory || p.config.Mandatory {
+		mandatory = true
+		dc.mandatory = true
+		dc.body = msg.Body
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		release()
+		return nil, ErrConfirmsClosed
+	}
+	p.pending = append(p.pending, dc)
+	p.mu.Unlock()
+
+	if err := p.pub.PublishWithContext(ctx, exchange, routingKey, mandatory, immediate, msg); err != nil {
+		p.mu.Lock()
+		p.remove(dc.tag)
+		p.mu.Unlock()
+		release()
+		return nil, err
+	}
+	p.nextTag = dc.tag
+	return dc, nil
+}
+
+// Flush waits until every publish outstanding at the time of the call is
+// confirmed. It returns the failed confirmations joined together, or ctx's
+// error when ctx is done first.
+func (p *ConfirmPublisher) Flush(ctx context.Context) error {
+	p.mu.Lock()
+	outstanding := slices.Clone(p.pending)
+	p.mu.Unlock()
+
+	var errs []error
+	for _, dc := range outstanding {
+		select {
+		case <-dc.done:
+			if dc.err != nil {
+				errs = append(errs, dc.err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes the underlying channel. Publishes still waiting for a
+// confirmation fail with ErrConfirmsClosed.
+func (p *ConfirmPublisher) Close() error {
+	return p.pub.Close()
+}
+
+// forget stops tracking dc after the caller gave up waiting for it with err.
+// It returns the outcome of dc: err, unless the confirmation arrived in the
+// meantime, in which case the broker's answer wins.
+func (p *ConfirmPublisher) forget(dc *DeferredConfirmation, err error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// listen removes and resolves confirmations under p.mu, so a publish that
+	// is no longer pending is already resolved.
+	if p.remove(dc.tag) != nil {
+		dc.resolve(err)
+	}
+	return dc.err
+}
+
+// remove stops tracking the publish with tag and returns it, or nil when it
+// is not pending. Called with p.mu held.
+func (p *ConfirmPublisher) remove(tag uint64) *DeferredConfirmation {
+	i, ok := slices.BinarySearchFunc(p.pending, tag, func(dc *DeferredConfirmation, tag uint64) int {
+		return cmp.Compare(dc.tag, tag)
+	})
+	if !ok {
+		return nil
+	}
+	dc := p.pending[i]
+	if i == 0 {
+		// Confirms mostly arrive in order, so avoid shifting the slice.
+		p.pending[0] = nil
+		p.pending = p.pending[1:]
+	} else {
+		p.pending = slices.Delete(p.pending, i, i+1)
+	}
+	return dc
+}
+
+// listen resolves pending publishes from broker confirmations until the channel closes.
+func (p *ConfirmPublisher) listen(confirms <-chan Confirmation, returns <-chan Return) {
+	for confirms != nil {
+		select {
+		case c, ok := <-confirms:
+			if !ok {
+				confirms = nil
+				continue
+			}
+			// The broker sends basic.return before the basic.ack of the same
+			// publish and the channel forwards both in that order, so drain
+			// returns first to see it before resolving.
+			returns = p.drainReturns(returns)
+			p.resolve(c)
+		case r, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			p.markReturned(r)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for _, dc := range p.pending {
+		dc.resolve(dc.fail(ErrConfirmsClosed))
+	}
+	p.pending = nil
+}
+
+// drainReturns records every return already queued. It returns nil once returns is closed.
+func (p *ConfirmPublisher) drainReturns(returns <-chan Return) <-chan Return {
+	for {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				return nil
+			}
+			p.markReturned(r)
+		default:
+			return returns
+		}
+	}
+}
+
+// markReturned attaches r to the oldest pending mandatory publish it matches.
+// Returns arrive in publish order, before the confirmation of their publish.
+func (p *ConfirmPublisher) markReturned(r Return) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, dc := range p.pending {
+		if dc.mandatory && dc.returned == nil && dc.exchange == r.Exchange &&
+			dc.routingKey == r.RoutingKey && bytes.Equal(dc.body, r.Body) {
+			dc.returned = &r
+			return
+		}
+	}
+}
+
+// resolve settles the pending publishes covered by c: the one with its tag,
+// and with Multiple every earlier one, which form a prefix of p.pending.
+func (p *ConfirmPublisher) resolve(c Confirmation) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var settled []*DeferredConfirmation
+	if c.Multiple {
+		n := 0
+		for n < len(p.pending) && p.pending[n].tag <= c.DeliveryTag {
+			n++
+		}
+		settled = slices.Clone(p.pending[:n])
+		clear(p.pending[:n])
+		p.pending = p.pending[n:]
+	} else if dc := p.remove(c.DeliveryTag); dc != nil {
+		settled = []*DeferredConfirmation{dc}
+	}
+
+	for _, dc := range settled {
+		var err error
+		switch {
+		case !c.Ack:
+			err = dc.fail(ErrNacked)
+		case dc.returned != nil:
+			err = dc.failReturned()
+		}
+		dc.resolve(err)
+	}
+}
+
+// DeliveryTag returns the publish sequence number the confirmation is tracked by.
+func (dc *DeferredConfirmation) DeliveryTag() uint64 {
+	return dc.tag
+}
+
+// Done returns a channel that is closed once the confirmation is resolved.
+func (dc *DeferredConfirmation) Done() <-chan struct{} {
+	return dc.done
+}
+
+// Acked reports whether the broker acknowledged the publish. It returns false
+// until Done is closed.
+func (dc *DeferredConfirmation) Acked() bool {
+	select {
+	case <-dc.done:
+		return dc.err == nil
+	default:
+		return false
+	}
+}
+
+// Wait blocks until the confirmation is resolved and returns nil on ack or a
+// *ConfirmError otherwise. When ctx is done first the error wraps ctx's error,
+// and ErrConfirmTimeout for deadlines.
+func (dc *DeferredConfirmation) Wait(ctx context.Context) error {
+	select {
+	case <-dc.done:
+		return dc.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return dc.fail(fmt.Errorf("%w: %w", ErrConfirmTimeout, ctx.Err()))
+		}
+		return dc.fail(ctx.Err())
+	}
+}
+
+func (dc *DeferredConfirmation) resolve(err error) {
+	dc.once.Do(func() {
+		dc.err = err
+		close(dc.done)
+		dc.release()
+	})
+}
+
+func (dc *DeferredConfirmation) fail(err error) error {
+	return &ConfirmError{
+		DeliveryTag: dc.tag,
+		Exchange:    dc.exchange,
+		RoutingKey:  dc.routingKey,
+		Err:         err,
+	}
+}
+
+func (dc *DeferredConfirmation) failReturned() error {
+	return &ConfirmError{
+		DeliveryTag: dc.tag,
+		Exchange:    dc.exchange,
+		RoutingKey:  dc.routingKey,
+		Err:         fmt.Errorf("%w (%d %s)", ErrUnroutable, dc.returned.ReplyCode, dc.returned.ReplyText),
+		Return:      dc.returned,
+	}
+}
@@ -0,0 +1,295 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfirmPublisher_Ack(t *testing.T) {
+	mock := &mockChannel{confirmFunc: func(uint64) bool { return true }}
+
+	pub, err := NewConfirmPublisher(mock, ConfirmConfig{Timeout: time.Second})
+	require.NoError(t, err)
+	require.True(t, mock.confirming)
+
+	err = pub.Publish(context.Background(), "exchange", "key", []byte("test"))
+	require.NoError(t, err)
+	require.Equal(t, "application/octet-stream", mock.lastPublish.msg.ContentType)
+}
+
+func TestConfirmPublisher_Nack(t *testing.T) {
+	mock := &mockChannel{confirmFunc: func(uint64) bool { return false }}
+
+	pub, err := NewConfirmPublisher(mock, ConfirmConfig{Timeout: time.Second})
+	require.NoError(t, err)
+
+	err = pub.Publish(context.Background(), "exchange", "key", []byte("test"))
+	require.ErrorIs(t, err, ErrNacked)
+
+	var confirmErr *ConfirmError
+	require.True(t, errors.As(err, &confirmErr))
+	require.Equal(t, uint64(1), confirmErr.DeliveryTag)
+	require.Equal(t, "exchange", confirmErr.Exchange)
+	require.Equal(t, "key", confirmErr.RoutingKey)
+}
+
+func TestConfirmPublisher_Timeout(t *testing.T) {
+	mock := &mockChannel{}
+
+	pub, err := NewConfirmPublisher(mock, ConfirmConfig{Timeout: 20 * time.Millisecond})
+	require.NoError(t, err)
+
+	err = pub.Publish(context.Background(), "exchange", "key", []byte("test"))
+	require.ErrorIs(t, err, ErrConfirmTimeout)
+}
+
+func TestConfirmPublisher_ContextDeadline(t *testing.T) {
+	mock := &mockChannel{}
+
+	pub, err := NewConfirmPublisher(mock, ConfirmConfig{})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err = pub.Publish(ctx, "exchange", "key", []byte("test"))
+	require.ErrorIs(t, err, ErrConfirmTimeout)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestConfirmPublisher_MultipleAck(t *testing.T) {
+	mock := &mockChannel{}
+
+	pub, err := NewConfirmPublisher(mock, ConfirmConfig{Timeout: time.Second})
+	require.NoError(t, err)
+
+	results := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			results <- pub.Publish(context.Background(), "exchange", "key", []byte("test"))
+		}()
+	}
+
+	require.Eventually(t, func() bool {
+		mock.mu.Lock()
+		defer mock.mu.Unlock()
+		return mock.publishTag == 2
+	}, time.Second, time.Millisecond)
+
+	mock.sendConfirmation(Confirmation{DeliveryTag: 2, Ack: true, Multiple: true})
+
+	require.NoError(t, <-results)
+	require.NoError(t, <-results)
+}
+
+func TestConfirmPublisher_OutOfOrderAcks(t *testing.T) {
+	mock := &mockChannel{}
+
+	pub, err := NewConfirmPublisher(mock, ConfirmConfig{})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	var dcs []*DeferredConfirmation
+	for i := 0; i < 4; i++ {
+		dc, err := pub.PublishAsync(ctx, "exchange", "key", false, false, Publishing{})
+		require.NoError(t, err)
+		dcs = append(dcs, dc)
+	}
+
+	mock.sendConfirmation(Confirmation{DeliveryTag: 2, Ack: true})
+	require.NoError(t, dcs[1].Wait(ctx))
+	mock.sendConfirmation(Confirmation{DeliveryTag: 3, Ack: false, Multiple: true})
+	require.ErrorIs(t, dcs[0].Wait(ctx), ErrNacked)
+	require.ErrorIs(t, dcs[2].Wait(ctx), ErrNacked)
+	require.False(t, dcs[3].Acked())
+
+	mock.sendConfirmation(Confirmation{DeliveryTag: 4, Ack: true})
+	require.NoError(t, pub.Flush(ctx))
+	require.True(t, dcs[3].Acked())
+}
+
+func TestConfirmPublisher_AckAfterTimeoutWins(t *testing.T) {
+	mock := &mockChannel{}
+
+	pub, err := NewConfirmPublisher(mock, ConfirmConfig{})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	acked, err := pub.PublishAsync(ctx, "exchange", "key", false, false, Publishing{})
+	require.NoError(t, err)
+	lost, err := pub.PublishAsync(ctx, "exchange", "key", false, false, Publishing{})
+	require.NoError(t, err)
+
+	// The ack arrives after Wait timed out but before the publisher forgets
+	// the publish: the broker's answer is reported, not the timeout.
+	mock.sendConfirmation(Confirmation{DeliveryTag: 1, Ack: true})
+	<-acked.Done()
+	require.NoError(t, pub.forget(acked, acked.fail(ErrConfirmTimeout)))
+
+	require.ErrorIs(t, pub.forget(lost, lost.fail(ErrConfirmTimeout)), ErrConfirmTimeout)
+	mock.sendConfirmation(Confirmation{DeliveryTag: 2, Ack: true})
+	require.ErrorIs(t, lost.Wait(ctx), ErrConfirmTimeout, "a forgotten publish keeps its timeout")
+}
+
+func TestConfirmPublisher_PublishError(t *testing.T) {
+	mock := &mockChannel{publishErr: errors.New("publish failed")}
+
+	pub, err := NewConfirmPublisher(mock, ConfirmConfig{Timeout: time.Second})
+	require.NoError(t, err)
+
+	err = pub.Publish(context.Background(), "exchange", "key", []byte("test"))
+	require.EqualError(t, err, "publish failed")
+}
+
+func TestConfirmPublisher_Close(t *testing.T) {
+	mock := &mockChannel{}
+
+	pub, err := NewConfirmPublisher(mock, ConfirmConfig{})
+	require.NoError(t, err)
+
+	result := make(chan error, 1)
+	go func() {
+		result <- pub.Publish(context.Background(), "exchange", "key", []byte("test"))
+	}()
+
+	require.Eventually(t, func() bool {
+		mock.mu.Lock()
+		defer mock.mu.Unlock()
+		return mock.publishTag == 1
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, pub.Close())
+	require.ErrorIs(t, <-result, ErrConfirmsClosed)
+
+	err = pub.Publish(context.Background(), "exchange", "key", []byte("test"))
+	require.ErrorIs(t, err, ErrConfirmsClosed)
+}
+
+func TestConfirmPublisher_PublishAsyncBoundsInFlight(t *testing.T) {
+	mock := &mockChannel{}
+
+	pub, err := NewConfirmPublisher(mock, ConfirmConfig{MaxInFlight: 2})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	first, err := pub.PublishAsync(ctx, "exchange", "key", false, false, Publishing{Body: []byte("1")})
+	require.NoError(t, err)
+	second, err := pub.PublishAsync(ctx, "exchange", "key", false, false, Publishing{Body: []byte("2")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), first.DeliveryTag())
+	require.Equal(t, uint64(2), second.DeliveryTag())
+	require.False(t, first.Acked())
+
+	blocked, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = pub.PublishAsync(blocked, "exchange", "key", false, false, Publishing{Body: []byte("3")})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	mock.sendConfirmation(Confirmation{DeliveryTag: 2, Ack: true, Multiple: true})
+
+	require.NoError(t, first.Wait(ctx))
+	require.NoError(t, second.Wait(ctx))
+	require.True(t, first.Acked())
+	require.True(t, second.Acked())
+
+	third, err := pub.PublishAsync(ctx, "exchange", "key", false, false, Publishing{Body: []byte("3")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), third.DeliveryTag())
+}
+
+func TestConfirmPublisher_Flush(t *testing.T) {
+	mock := &mockChannel{}
+
+	pub, err := NewConfirmPublisher(mock, ConfirmConfig{})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		_, err := pub.PublishAsync(ctx, "exchange", "key", false, false, Publishing{Body: []byte("msg")})
+		require.NoError(t, err)
+	}
+
+	short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, pub.Flush(short), context.DeadlineExceeded)
+
+	go func() {
+		mock.sendConfirmation(Confirmation{DeliveryTag: 1, Ack: true})
+		mock.sendConfirmation(Confirmation{DeliveryTag: 2, Ack: false})
+		mock.sendConfirmation(Confirmation{DeliveryTag: 3, Ack: true})
+	}()
+
+	err = pub.Flush(ctx)
+	require.ErrorIs(t, err, ErrNacked)
+
+	var confirmErr *ConfirmError
+	require.True(t, errors.As(err, &confirmErr))
+	require.Equal(t, uint64(2), confirmErr.DeliveryTag)
+
+	require.NoError(t, pub.Flush(ctx))
+}
+
+func TestConfirmPublisher_MandatoryUnroutable(t *testing.T) {
+	mock := &mockChannel{
+		confirmFunc: func(uint64) bool { return true },
+		returnFunc:  func(exchange, routingKey string) bool { return routingKey == "nowhere" },
+	}
+
+	pub, err := NewConfirmPublisher(mock, ConfirmConfig{Timeout: time.Second, Mandatory: true})
+	require.NoError(t, err)
+
+	err = pub.Publish(context.Background(), "exchange", "nowhere", []byte("lost"))
+	require.ErrorIs(t, err, ErrUnroutable)
+	require.True(t, mock.lastPublish.mandatory)
+
+	var confirmErr *ConfirmError
+	require.True(t, errors.As(err, &confirmErr))
+	require.NotNil(t, confirmErr.Return)
+	require.Equal(t, ReplyNoRoute, confirmErr.Return.ReplyCode)
+	require.Equal(t, []byte("lost"), confirmErr.Return.Body)
+
+	err = pub.Publish(context.Background(), "exchange", "routed", []byte("kept"))
+	require.NoError(t, err)
+}
+
+func TestConfirmPublisher_MandatoryDoesNotMutateHeaders(t *testing.T) {
+	mock := &mockChannel{confirmFunc: func(uint64) bool { return true }}
+
+	pub, err := NewConfirmPublisher(mock, ConfirmConfig{Timeout: time.Second})
+	require.NoError(t, err)
+
+	headers := Table{"tenant": "acme"}
+	err = pub.PublishWithOptions(context.Background(), "exchange", "key", true, false, Publishing{Headers: headers})
+	require.NoError(t, err)
+
+	require.Equal(t, Table{"tenant": "acme"}, headers)
+	require.Equal(t, Table{"tenant": "acme"}, mock.lastPublish.msg.Headers, "no correlation header is added")
+}
+
+func TestConfirmPublisher_ReturnMatchesPublish(t *testing.T) {
+	mock := &mockChannel{}
+
+	pub, err := NewConfirmPublisher(mock, ConfirmConfig{Mandatory: true})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	var dcs []*DeferredConfirmation
+	for _, body := range []string{"a", "b", "b", "c"} {
+		dc, err := pub.PublishAsync(ctx, "exchange", "key", false, false, Publishing{Body: []byte(body)})
+		require.NoError(t, err)
+		dcs = append(dcs, dc)
+	}
+
+	mock.sendReturn(Return{ReplyCode: ReplyNoRoute, Exchange: "exchange", RoutingKey: "key", Body: []byte("b")})
+	mock.sendReturn(Return{ReplyCode: ReplyNoRoute, Exchange: "exchange", RoutingKey: "other", Body: []byte("c")})
+	mock.sendConfirmation(Confirmation{DeliveryTag: 4, Ack: true, Multiple: true})
+
+	require.NoError(t, dcs[0].Wait(ctx))
+	require.ErrorIs(t, dcs[1].Wait(ctx), ErrUnroutable, "the oldest matching publish takes the return")
+	require.NoError(t, dcs[2].Wait(ctx))
+	require.NoError(t, dcs[3].Wait(ctx), "a return for another routing key does not match")
+}
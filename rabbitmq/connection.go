@@ -0,0 +1,828 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrNotConnected is returned by managed channels while the connection is being re-established.
+	ErrNotConnected = errors.New("rabbitmq: not connected")
+	// ErrClosed is returned by a Connection or managed channel after Close.
+	ErrClosed = errors.New("rabbitmq: connection closed")
+)
+
+// ConnectionConfig holds configuration for a Connection.
+type ConnectionConfig struct {
+	// Backoff controls the delay between reconnect attempts.
+	Backoff Backoff
+
+	// OnDisconnect is called when the connection to the broker is lost.
+	OnDisconnect func(err error)
+	// OnReconnect is called after the connection was re-established on the given attempt.
+	OnReconnect func(attempt int)
+	// OnReconnectError is called for every failed reconnect attempt.
+	OnReconnectError func(attempt int, err error)
+
+	// Logger is passed to the channels of the connection. Defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// connector is the broker connection a Connection dials and watches.
+type connector interface {
+	channel() (Channel, error)
+	notifyClose() <-chan error
+	close() error
+}
+
+// channelWatcher is implemented by channels that report abnormal closes.
+type channelWatcher interface {
+	notifyClose() <-chan error
+	closeErr() error
+}
+
+// Connection is a RabbitMQ connection that reconnects with jittered exponential
+// backoff when the broker goes away. Channels it gives out survive reconnects:
+// consumers are re-subscribed and confirm mode is restored on the new channel.
+type Connection struct {
+	config ConnectionConfig
+	dial   func() (connector, error)
+
+	mu       sync.Mutex
+	conn     connector
+	ready    chan struct{} // closed while conn is usable
+	channels map[*managedChannel]struct{}
+	closed   bool
+	done     chan struct{}
+}
+
+// Dial connects to the broker at url and keeps the connection alive until Close.
+func Dial(url string, config ConnectionConfig) (*Connection, error) {
+	return newConnection(func() (connector, error) { return dialAMQP(url, config.Logger) }, config)
+}
+
+func newConnection(dial func() (connector, error), config ConnectionConfig) (*Connection, error) {
+	conn, err := dial()
+	if err != nil {
+		return nil, fmt.Errorf("connection: dial: %w", err)
+	}
+
+	c := &Connection{
+		config:   config,
+		dial:     dial,
+		conn:     conn,
+		ready:    make(chan struct{}),
+		channels: make(map[*managedChannel]struct{}),
+		done:     make(chan struct{}),
+	}
+	close(c.ready)
+	go c.watch(conn)
+	return c, nil
+}
+
+// Channel opens a Channel that is transparently reopened after reconnects.
+func (c *Connection) Channel() (Channel, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrClosed
+	}
+	m := &managedChannel{
+		conn:      c,
+		ready:     make(chan struct{}),
+		consumers: make(map[string]*managedConsumer),
+	}
+	c.channels[m] = struct{}{}
+	conn := c.conn
+	c.mu.Unlock()
+
+	if conn == nil {
+		go m.reopen()
+		return m, nil
+	}
+	ch, err := conn.channel()
+	if err != nil {
+		c.forget(m)
+		return nil, fmt.Errorf("connection: open channel: %w", err)
+	}
+	m.open(ch)
+	return m, nil
+}
+
+// Close closes every channel and the connection and stops reconnecting.
+func (c *Connection) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.closed = true
+	close(c.done)
+	conn := c.conn
+	c.conn = nil
+	channels := make([]*managedChannel, 0, len(c.channels))
+	for m := range c.channels {
+		channels = append(channels, m)
+	}
+	c.mu.Unlock()
+
+	for _, m := range channels {
+		_ = m.Close()
+	}
+	if conn == nil {
+		return nil
+	}
+	return conn.close()
+}
+
+// current returns the live connection, or nil and a channel closed once connected.
+func (c *Connection) current() (connector, <-chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn, c.ready
+}
+
+func (c *Connection) forget(m *managedChannel) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.channels, m)
+}
+
+// watch reconnects every time conn is lost until the Connection is closed.
+func (c *Connection) watch(conn connector) {
+	for {
+		var err error
+		select {
+		case err = <-conn.notifyClose():
+		case <-c.done:
+			return
+		}
+
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			return
+		}
+		c.conn = nil
+		c.ready = make(chan struct{})
+		c.mu.Unlock()
+
+		if c.config.OnDisconnect != nil {
+			c.config.OnDisconnect(err)
+		}
+
+		if conn = c.reconnect(); conn == nil {
+			return
+		}
+	}
+}
+
+// reconnect dials until it succeeds or the Connection is closed.
+func (c *Connection) reconnect() connector {
+	for attempt := 1; ; attempt++ {
+		conn, err := c.dial()
+		if err == nil {
+			c.mu.Lock()
+			if c.closed {
+				c.mu.Unlock()
+				_ = conn.close()
+				return nil
+			}
+			c.conn = conn
+			close(c.ready)
+			c.mu.Unlock()
+
+			if c.config.OnReconnect != nil {
+				c.config.OnReconnect(attempt)
+			}
+			return conn
+		}
+
+		if c.config.OnReconnectError != nil {
+			c.config.OnReconnectError(attempt, err)
+		}
+		if !sleep(c.config.Backoff.Duration(attempt), c.done) {
+			return nil
+		}
+	}
+}
+
+// managedChannel is a Channel whose underlying channel is replaced after
+// the connection or the channel itself is lost.
+type managedChannel struct {
+	conn *Connection
+
+	mu         sync.Mutex
+	gen        *generation   // current underlying channel, nil while disconnected
+	ready      chan struct{} // closed while gen is usable
+	closed     bool
+	confirming bool
+	qos        *qosSetting // prefetch applied to every generation
+	consumers  map[string]*managedConsumer
+
+	notifyMu sync.Mutex
+	confirms []chan Confirmation
+	returns  []chan Return
+
+	publishMu sync.Mutex // orders confirm-mode publishes with delivery tag accounting
+	tagOffset uint64     // delivery tags used on previous underlying channels
+}
+
+// generation is one underlying channel of a managedChannel.
+type generation struct {
+	ch     Channel
+	lost   chan struct{}
+	offset uint64 // added to delivery tags so they keep growing across generations
+
+	published  uint64 // confirm-mode publishes, guarded by managedChannel.publishMu
+	confirming atomic.Bool
+	notifyOnce sync.Once // starts forwardNotifications
+}
+
+// managedConsumer is a consumer that is re-subscribed on every new generation.
+type managedConsumer struct {
+	queue, tag                          string
+	autoAck, exclusive, noLocal, noWait bool
+	args                                Table
+	out                                 chan Delivery
+	closeOnce                           sync.Once
+
+	// guarded by managedChannel.mu
+	active    bool // a forward goroutine owns out
+	cancelled bool
+}
+
+// qosSetting holds the arguments of the last Qos call.
+type qosSetting struct {
+	prefetchCount, prefetchSize int
+	global                      bool
+}
+
+// consumerSeq numbers generated consumer tags.
+var consumerSeq atomic.Uint64
+
+// open installs ch as the current underlying channel and restores state on it.
+func (m *managedChannel) open(ch Channel) {
+	m.publishMu.Lock()
+	m.mu.Lock()
+	if m.closed || m.gen != nil {
+		m.mu.Unlock()
+		m.publishMu.Unlock()
+		_ = ch.Close()
+		return
+	}
+	gen := &generation{ch: ch, lost: make(chan struct{}), offset: m.tagOffset}
+	m.gen = gen
+	m.publishMu.Unlock()
+
+	if m.qos != nil {
+		_ = ch.Qos(m.qos.prefetchCount, m.qos.prefetchSize, m.qos.global)
+	}
+	if m.confirming {
+		_ = m.enableConfirms(gen)
+	}
+	m.notifyMu.Lock()
+	if len(m.returns) > 0 {
+		m.enableReturns(gen)
+	}
+	m.notifyMu.Unlock()
+	for _, mc := range m.consumers {
+		if !mc.active {
+			mc.active = true
+			go m.consume(gen, mc)
+		}
+	}
+	close(m.ready)
+	m.mu.Unlock()
+
+	if w, ok := ch.(channelWatcher); ok {
+		go m.watch(gen, w.notifyClose())
+	}
+}
+
+// watch waits for gen to close and reopens the channel unless it was closed on purpose.
+func (m *managedChannel) watch(gen *generation, closed <-chan error) {
+	for range closed {
+	}
+
+	m.publishMu.Lock()
+	m.mu.Lock()
+	if m.gen != gen {
+		m.mu.Unlock()
+		m.publishMu.Unlock()
+		return
+	}
+	m.gen = nil
+	m.ready = make(chan struct{})
+	m.tagOffset = gen.offset + gen.published
+	shutdown := m.closed
+	m.mu.Unlock()
+	m.publishMu.Unlock()
+	close(gen.lost)
+
+	if !shutdown {
+		m.reopen()
+	}
+}
+
+// reopen opens a new underlying channel as soon as the connection allows it.
+func (m *managedChannel) reopen() {
+	c := m.conn
+	for attempt := 1; ; attempt++ {
+		conn, ready := c.current()
+		if conn == nil {
+			select {
+			case <-ready:
+				attempt = 0
+				continue
+			case <-c.done:
+				return
+			}
+		}
+
+		ch, err := conn.channel()
+		if err == nil {
+			m.open(ch)
+			return
+		}
+		if !sleep(c.config.Backoff.Duration(attempt), c.done) {
+			return
+		}
+	}
+}
+
+// current returns the live generation without waiting.
+func (m *managedChannel) current() (*generation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+	if m.gen == nil {
+		return nil, ErrNotConnected
+	}
+	return m.gen, nil
+}
+
+// await returns the live generation, waiting for a reconnect until ctx is done.
+func (m *managedChannel) await(ctx context.Context) (*generation, error) {
+	for {
+		m.mu.Lock()
+		gen, ready, closed := m.gen, m.ready, m.closed
+		m.mu.Unlock()
+
+		switch {
+		case closed:
+			return nil, ErrClosed
+		case gen != nil:
+			return gen, nil
+		}
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %w", ErrNotConnected, ctx.Err())
+		}
+	}
+}
+
+// publish runs fn on gen and counts the publish when gen is in confirm mode.
+func (m *managedChannel) publish(gen *generation, fn func(Channel) error) error {
+	m.publishMu.Lock()
+	defer m.publishMu.Unlock()
+
+	m.mu.Lock()
+	stale := m.gen != gen
+	m.mu.Unlock()
+	if stale {
+		return ErrNotConnected
+	}
+
+	if err := fn(gen.ch); err != nil {
+		return err
+	}
+	if gen.confirming.Load() {
+		gen.published++
+	}
+	return nil
+}
+
+func (m *managedChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args Table) error {
+	gen, err := m.current()
+	if err != nil {
+		return err
+	}
+	return gen.ch.ExchangeDeclare(name, kind, durable, autoDelete, internal, noWait, args)
+}
+
+func (m *managedChannel) Publish(exchange, routingKey string, body []byte) error {
+	gen, err := m.current()
+	if err != nil {
+		return err
+	}
+	return m.publish(gen, func(ch Channel) error { return ch.Publish(exchange, routingKey, body) })
+}
+
+func (m *managedChannel) PublishWithOptions(exchange, routingKey string, mandatory, immediate bool, msg Publishing) error {
+	gen, err := m.current()
+	if err != nil {
+		return err
+	}
+	return m.publish(gen, func(ch Channel) error {
+		return ch.PublishWithOptions(exchange, routingKey, mandatory, immediate, msg)
+	})
+}
+
+// PublishWithContext waits for a reconnect in progress until ctx is done before publishing.
+func (m *managedChannel) PublishWithContext(ctx context.Context, exchange, routingKey string, mandatory, immediate bool, msg Publishing) error {
+	for {
+		gen, err := m.await(ctx)
+		if err != nil {
+			return err
+		}
+		err = m.publish(gen, func(ch Channel) error {
+			return ch.PublishWithContext(ctx, exchange, routingKey, mandatory, immediate, msg)
+		})
+		if !errors.Is(err, ErrNotConnected) {
+			return err
+		}
+	}
+}
+
+// Confirm puts the current and every future underlying channel into confirm mode.
+func (m *managedChannel) Confirm(noWait bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	m.confirming = true
+	if m.gen == nil {
+		return nil
+	}
+	return m.enableConfirms(m.gen)
+}
+
+// enableConfirms puts gen into confirm mode and forwards its confirmations
+// with delivery tags shifted by the generation offset. Called with m.mu held.
+func (m *managedChannel) enableConfirms(gen *generation) error {
+	if gen.confirming.Load() {
+		return nil
+	}
+	if err := gen.ch.Confirm(false); err != nil {
+		return err
+	}
+	gen.confirming.Store(true)
+	gen.notifyOnce.Do(func() { m.forwardNotifications(gen) })
+	return nil
+}
+
+// forwardNotifications passes the confirmations and returns of gen to the
+// listeners on one goroutine. A return precedes the confirmation of its
+// publish, so the returns already received are forwarded before each
+// confirmation.
+func (m *managedChannel) forwardNotifications(gen *generation) {
+	var confirms <-chan Confirmation = gen.ch.NotifyPublish(make(chan Confirmation, DefaultMaxInFlight))
+	var returns <-chan Return = gen.ch.NotifyReturn(make(chan Return, DefaultMaxInFlight))
+	go func() {
+		last := gen.offset
+		for confirms != nil || returns != nil {
+			select {
+			case c, ok := <-confirms:
+				if !ok {
+					confirms = nil
+					m.nackUnconfirmed(gen, last)
+					continue
+				}
+				returns = m.drainReturns(returns)
+				c.DeliveryTag += gen.offset
+				last = c.DeliveryTag
+				m.sendConfirmation(c)
+			case r, ok := <-returns:
+				if !ok {
+					returns = nil
+					continue
+				}
+				m.sendReturn(r)
+			}
+		}
+	}()
+}
+
+// nackUnconfirmed nacks the publishes after last that gen never confirmed:
+// they are lost with the old channel.
+func (m *managedChannel) nackUnconfirmed(gen *generation, last uint64) {
+	m.publishMu.Lock()
+	published := gen.offset + gen.published
+	m.publishMu.Unlock()
+	for tag := last + 1; tag <= published; tag++ {
+		m.sendConfirmation(Confirmation{DeliveryTag: tag, Ack: false})
+	}
+}
+
+// drainReturns forwards every return already queued. It returns nil once returns is closed.
+func (m *managedChannel) drainReturns(returns <-chan Return) <-chan Return {
+	for {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				return nil
+			}
+			m.sendReturn(r)
+		default:
+			return returns
+		}
+	}
+}
+
+func (m *managedChannel) NotifyPublish(confirm chan Confirmation) chan Confirmation {
+	m.notifyMu.Lock()
+	defer m.notifyMu.Unlock()
+	m.confirms = append(m.confirms, confirm)
+	return confirm
+}
+
+func (m *managedChannel) sendConfirmation(c Confirmation) {
+	m.notifyMu.Lock()
+	defer m.notifyMu.Unlock()
+	for _, l := range m.confirms {
+		l <- c
+	}
+}
+
+func (m *managedChannel) NotifyReturn(c chan Return) chan Return {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notifyMu.Lock()
+	defer m.notifyMu.Unlock()
+	m.returns = append(m.returns, c)
+	if m.gen != nil {
+		m.enableReturns(m.gen)
+	}
+	return c
+}
+
+// enableReturns forwards returned messages of gen. Called with m.mu held.
+func (m *managedChannel) enableReturns(gen *generation) {
+	gen.notifyOnce.Do(func() { m.forwardNotifications(gen) })
+}
+
+func (m *managedChannel) sendReturn(r Return) {
+	m.notifyMu.Lock()
+	defer m.notifyMu.Unlock()
+	for _, l := range m.returns {
+		l <- r
+	}
+}
+
+func (m *managedChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args Table) (Queue, error) {
+	gen, err := m.current()
+	if err != nil {
+		return Queue{}, err
+	}
+	return gen.ch.QueueDeclare(name, durable, autoDelete, exclusive, noWait, args)
+}
+
+func (m *managedChannel) QueueBind(name, key, exchange string, noWait bool, args Table) error {
+	gen, err := m.current()
+	if err != nil {
+		return err
+	}
+	return gen.ch.QueueBind(name, key, exchange, noWait, args)
+}
+
+func (m *managedChannel) ExchangeBind(destination, key, source string, noWait bool, args Table) error {
+	gen, err := m.current()
+	if err != nil {
+		return err
+	}
+	return gen.ch.ExchangeBind(destination, key, source, noWait, args)
+}
+
+func (m *managedChannel) ExchangeUnbind(destination, key, source string, noWait bool, args Table) error {
+	gen, err := m.current()
+	if err != nil {
+		return err
+	}
+	return gen.ch.ExchangeUnbind(destination, key, source, noWait, args)
+}
+
+func (m *managedChannel) ExchangeDelete(name string, ifUnused, noWait bool) error {
+	gen, err := m.current()
+	if err != nil {
+		return err
+	}
+	return gen.ch.ExchangeDelete(name, ifUnused, noWait)
+}
+
+func (m *managedChannel) QueueUnbind(name, key, exchange string, args Table) error {
+	gen, err := m.current()
+	if err != nil {
+		return err
+	}
+	return gen.ch.QueueUnbind(name, key, exchange, args)
+}
+
+func (m *managedChannel) QueueInspect(name string) (Queue, error) {
+	gen, err := m.current()
+	if err != nil {
+		return Queue{}, err
+	}
+	return gen.ch.QueueInspect(name)
+}
+
+func (m *managedChannel) QueueDelete(name string, ifUnused, ifEmpty, noWait bool) (int, error) {
+	gen, err := m.current()
+	if err != nil {
+		return 0, err
+	}
+	return gen.ch.QueueDelete(name, ifUnused, ifEmpty, noWait)
+}
+
+func (m *managedChannel) QueuePurge(name string, noWait bool) (int, error) {
+	gen, err := m.current()
+	if err != nil {
+		return 0, err
+	}
+	return gen.ch.QueuePurge(name, noWait)
+}
+
+// Get fetches a single message. Deliveries fetched without autoAck must be
+// settled before the channel is reopened after a reconnect.
+func (m *managedChannel) Get(queue string, autoAck bool) (Delivery, bool, error) {
+	gen, err := m.current()
+	if err != nil {
+		return Delivery{}, false, err
+	}
+	return gen.ch.Get(queue, autoAck)
+}
+
+// Qos sets the prefetch of the current and every future underlying channel.
+func (m *managedChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrClosed
+	}
+	m.qos = &qosSetting{prefetchCount: prefetchCount, prefetchSize: prefetchSize, global: global}
+	if m.gen == nil {
+		return nil
+	}
+	return m.gen.ch.Qos(prefetchCount, prefetchSize, global)
+}
+
+// Consume returns a delivery channel that stays open across reconnects. It is
+// closed when the consumer is cancelled, by the caller or by the broker.
+func (m *managedChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args Table) (<-chan Delivery, error) {
+	if consumer == "" {
+		consumer = fmt.Sprintf("xconnect-%d", consumerSeq.Add(1))
+	}
+	mc := &managedConsumer{
+		queue:     queue,
+		tag:       consumer,
+		autoAck:   autoAck,
+		exclusive: exclusive,
+		noLocal:   noLocal,
+		noWait:    noWait,
+		args:      args,
+		out:       make(chan Delivery),
+		active:    true,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrClosed
+	}
+	if m.gen == nil {
+		return nil, ErrNotConnected
+	}
+	deliveries, err := m.gen.ch.Consume(queue, consumer, autoAck, exclusive, noLocal, noWait, args)
+	if err != nil {
+		return nil, err
+	}
+	m.consumers[consumer] = mc
+	go m.forward(m.gen, mc, deliveries)
+	return mc.out, nil
+}
+
+// consume re-subscribes mc on gen after a reconnect.
+func (m *managedChannel) consume(gen *generation, mc *managedConsumer) {
+	deliveries, err := gen.ch.Consume(mc.queue, mc.tag, mc.autoAck, mc.exclusive, mc.noLocal, mc.noWait, mc.args)
+	if err != nil {
+		m.mu.Lock()
+		m.dropConsumer(mc)
+		m.mu.Unlock()
+		return
+	}
+	m.forward(gen, mc, deliveries)
+}
+
+// forward copies deliveries to mc until gen's consumer ends. It is the only
+// writer of mc.out and closes it when the consumer is not carried over to
+// the next generation.
+func (m *managedChannel) forward(gen *generation, mc *managedConsumer, deliveries <-chan Delivery) {
+	lost := false
+loop:
+	for {
+		select {
+		case d, ok := <-deliveries:
+			if !ok {
+				break loop
+			}
+			select {
+			case mc.out <- d:
+			case <-gen.lost:
+				lost = true
+				break loop
+			}
+		case <-gen.lost:
+			lost = true
+			break loop
+		}
+	}
+	if w, ok := gen.ch.(channelWatcher); ok && w.closeErr() != nil {
+		lost = true
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case m.closed || mc.cancelled || !lost:
+		m.dropConsumer(mc)
+	case m.gen != nil && m.gen != gen:
+		// A new generation opened while this one was winding down.
+		go m.consume(m.gen, mc)
+	default:
+		mc.active = false
+	}
+}
+
+// dropConsumer forgets mc and closes its delivery channel. Called with m.mu held.
+func (m *managedChannel) dropConsumer(mc *managedConsumer) {
+	if m.consumers[mc.tag] == mc {
+		delete(m.consumers, mc.tag)
+	}
+	mc.active = false
+	mc.closeOnce.Do(func() { close(mc.out) })
+}
+
+// Cancel stops the consumer; its delivery channel is closed once drained.
+func (m *managedChannel) Cancel(consumer string, noWait bool) error {
+	m.mu.Lock()
+	gen := m.gen
+	if mc, ok := m.consumers[consumer]; ok {
+		mc.cancelled = true
+		if !mc.active {
+			m.dropConsumer(mc)
+		}
+	}
+	m.mu.Unlock()
+
+	if gen == nil {
+		return nil
+	}
+	return gen.ch.Cancel(consumer, noWait)
+}
+
+// Close closes the underlying channel and every delivery and notification channel.
+func (m *managedChannel) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return ErrClosed
+	}
+	m.closed = true
+	gen := m.gen
+	m.gen = nil
+	for _, mc := range m.consumers {
+		if !mc.active {
+			m.dropConsumer(mc)
+		}
+	}
+	m.mu.Unlock()
+
+	m.conn.forget(m)
+
+	var err error
+	if gen != nil {
+		err = gen.ch.Close()
+		close(gen.lost)
+	}
+
+	m.notifyMu.Lock()
+	defer m.notifyMu.Unlock()
+	for _, l := range m.confirms {
+		close(l)
+	}
+	for _, l := range m.returns {
+		close(l)
+	}
+	m.confirms, m.returns = nil, nil
+	return err
+}
+
+var _ Channel = (*managedChannel)(nil)
@@ -0,0 +1,309 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConnector is a connector whose loss can be simulated.
+type fakeConnector struct {
+	mu       sync.Mutex
+	channels []*fakeChannel
+	closed   chan error
+	dead     bool
+}
+
+func newFakeConnector() *fakeConnector {
+	return &fakeConnector{closed: make(chan error, 1)}
+}
+
+func (f *fakeConnector) channel() (Channel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.dead {
+		return nil, errors.New("connection is closed")
+	}
+	ch := &fakeChannel{
+		mockChannel: &mockChannel{messages: make(chan Delivery, 10)},
+		closeCh:     make(chan error, 1),
+	}
+	f.channels = append(f.channels, ch)
+	return ch, nil
+}
+
+func (f *fakeConnector) notifyClose() <-chan error { return f.closed }
+func (f *fakeConnector) close() error              { return nil }
+
+// kill simulates the broker dropping the connection and all its channels.
+func (f *fakeConnector) kill(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dead = true
+	for _, ch := range f.channels {
+		ch.kill(err)
+	}
+	f.closed <- err
+	close(f.closed)
+}
+
+func (f *fakeConnector) channelAt(i int) *fakeChannel {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if i >= len(f.channels) {
+		return nil
+	}
+	return f.channels[i]
+}
+
+// fakeChannel is a mockChannel that reports abnormal closes like the amqp wrapper.
+type fakeChannel struct {
+	*mockChannel
+	closeCh   chan error
+	closeOnce sync.Once
+	lostMu    sync.Mutex
+	lost      error
+}
+
+func (f *fakeChannel) notifyClose() <-chan error { return f.closeCh }
+
+func (f *fakeChannel) closeErr() error {
+	f.lostMu.Lock()
+	defer f.lostMu.Unlock()
+	return f.lost
+}
+
+func (f *fakeChannel) Close() error {
+	f.closeOnce.Do(func() { close(f.closeCh) })
+	return f.mockChannel.Close()
+}
+
+func (f *fakeChannel) kill(err error) {
+	f.lostMu.Lock()
+	f.lost = err
+	f.lostMu.Unlock()
+	f.closeOnce.Do(func() {
+		f.closeCh <- err
+		close(f.closeCh)
+	})
+	close(f.messages)
+	_ = f.mockChannel.Close()
+}
+
+// fakeDialer hands out a new fakeConnector on every dial.
+type fakeDialer struct {
+	mu    sync.Mutex
+	conns []*fakeConnector
+}
+
+func (d *fakeDialer) dial() (connector, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	conn := newFakeConnector()
+	d.conns = append(d.conns, conn)
+	return conn, nil
+}
+
+func (d *fakeDialer) channel(conn, ch int) *fakeChannel {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if conn >= len(d.conns) {
+		return nil
+	}
+	return d.conns[conn].channelAt(ch)
+}
+
+func (d *fakeDialer) conn(i int) *fakeConnector {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.conns[i]
+}
+
+var fastBackoff = Backoff{Min: time.Millisecond, Max: 5 * time.Millisecond}
+
+func TestConnection_ReconnectResumesConsumeAndPublish(t *testing.T) {
+	dialer := &fakeDialer{}
+	disconnected := make(chan error, 1)
+	reconnected := make(chan int, 1)
+
+	conn, err := newConnection(dialer.dial, ConnectionConfig{
+		Backoff:      fastBackoff,
+		OnDisconnect: func(err error) { disconnected <- err },
+		OnReconnect:  func(attempt int) { reconnected <- attempt },
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	require.NoError(t, err)
+
+	require.NoError(t, ch.Qos(5, 0, false))
+	msgs, err := ch.Consume("queue", "consumer", true, false, false, false, nil)
+	require.NoError(t, err)
+
+	dialer.channel(0, 0).messages <- Delivery{Body: []byte("before")}
+	require.Equal(t, []byte("before"), (<-msgs).Body)
+
+	lostErr := errors.New("broker restarted")
+	dialer.conn(0).kill(lostErr)
+
+	require.Equal(t, lostErr, <-disconnected)
+	require.Equal(t, 1, <-reconnected)
+
+	require.Eventually(t, func() bool { return dialer.channel(1, 0) != nil }, time.Second, time.Millisecond)
+	dialer.channel(1, 0).messages <- Delivery{Body: []byte("after")}
+
+	select {
+	case msg := <-msgs:
+		require.Equal(t, []byte("after"), msg.Body)
+	case <-time.After(time.Second):
+		t.Fatal("consumer was not resumed after reconnect")
+	}
+
+	require.NoError(t, ch.Publish("exchange", "key", []byte("hello")))
+	second := dialer.channel(1, 0)
+	second.mu.Lock()
+	defer second.mu.Unlock()
+	require.Equal(t, []byte("hello"), second.lastPublish.msg.Body)
+	require.Equal(t, 5, second.prefetchCount)
+}
+
+func TestConnection_ConfirmTagsSurviveReconnect(t *testing.T) {
+	dialer := &fakeDialer{}
+
+	conn, err := newConnection(dialer.dial, ConnectionConfig{Backoff: fastBackoff})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	require.NoError(t, err)
+	require.NoError(t, ch.Confirm(false))
+	confirms := ch.NotifyPublish(make(chan Confirmation, 10))
+
+	first := dialer.channel(0, 0)
+	require.True(t, first.confirming)
+	require.NoError(t, ch.Publish("exchange", "key", []byte("1")))
+	require.NoError(t, ch.Publish("exchange", "key", []byte("2")))
+
+	first.sendConfirmation(Confirmation{DeliveryTag: 1, Ack: true})
+	require.Equal(t, Confirmation{DeliveryTag: 1, Ack: true}, <-confirms)
+
+	dialer.conn(0).kill(errors.New("connection reset"))
+	require.Equal(t, Confirmation{DeliveryTag: 2, Ack: false}, <-confirms)
+
+	require.Eventually(t, func() bool {
+		second := dialer.channel(1, 0)
+		if second == nil {
+			return false
+		}
+		second.mu.Lock()
+		defer second.mu.Unlock()
+		return second.confirming
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, ch.Publish("exchange", "key", []byte("3")))
+	dialer.channel(1, 0).sendConfirmation(Confirmation{DeliveryTag: 1, Ack: true})
+	require.Equal(t, Confirmation{DeliveryTag: 3, Ack: true}, <-confirms)
+}
+
+func TestConnection_ReturnsPrecedeConfirms(t *testing.T) {
+	dialer := &fakeDialer{}
+
+	conn, err := newConnection(dialer.dial, ConnectionConfig{Backoff: fastBackoff})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	require.NoError(t, err)
+	inner := dialer.channel(0, 0)
+	inner.mu.Lock()
+	inner.confirmFunc = func(uint64) bool { return true }
+	inner.returnFunc = func(_, routingKey string) bool { return routingKey == "nowhere" }
+	inner.mu.Unlock()
+
+	pub, err := NewConfirmPublisher(ch, ConfirmConfig{Timeout: time.Second, Mandatory: true})
+	require.NoError(t, err)
+
+	// Every return reaches the publisher before the ack of the same publish.
+	for i := 0; i < 100; i++ {
+		err := pub.Publish(context.Background(), "exchange", "nowhere", []byte("lost"))
+		require.ErrorIs(t, err, ErrUnroutable, "publish %d", i)
+	}
+}
+
+func TestConnection_PublishWhileDisconnected(t *testing.T) {
+	dialer := &fakeDialer{}
+	block := make(chan struct{})
+	dial := func() (connector, error) {
+		dialer.mu.Lock()
+		n := len(dialer.conns)
+		dialer.mu.Unlock()
+		if n > 0 {
+			<-block
+		}
+		return dialer.dial()
+	}
+
+	conn, err := newConnection(dial, ConnectionConfig{Backoff: fastBackoff})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ch, err := conn.Channel()
+	require.NoError(t, err)
+
+	dialer.conn(0).kill(errors.New("connection reset"))
+	require.Eventually(t, func() bool {
+		return errors.Is(ch.Publish("exchange", "key", nil), ErrNotConnected)
+	}, time.Second, time.Millisecond)
+
+	close(block)
+	require.Eventually(t, func() bool {
+		return ch.Publish("exchange", "key", []byte("back")) == nil
+	}, time.Second, time.Millisecond)
+}
+
+func TestConnection_CancelAndClose(t *testing.T) {
+	dialer := &fakeDialer{}
+
+	conn, err := newConnection(dialer.dial, ConnectionConfig{Backoff: fastBackoff})
+	require.NoError(t, err)
+
+	ch, err := conn.Channel()
+	require.NoError(t, err)
+
+	msgs, err := ch.Consume("queue", "consumer", true, false, false, false, nil)
+	require.NoError(t, err)
+	require.NoError(t, ch.Cancel("consumer", false))
+
+	_, open := <-msgs
+	require.False(t, open)
+
+	confirms := ch.NotifyPublish(make(chan Confirmation, 1))
+	require.NoError(t, conn.Close())
+
+	_, open = <-confirms
+	require.False(t, open)
+	require.ErrorIs(t, ch.Publish("exchange", "key", nil), ErrClosed)
+	require.ErrorIs(t, conn.Close(), ErrClosed)
+
+	_, err = conn.Channel()
+	require.ErrorIs(t, err, ErrClosed)
+}
+
+func TestBackoff_Duration(t *testing.T) {
+	b := Backoff{Min: 100 * time.Millisecond, Max: time.Second}
+
+	for attempt := 1; attempt <= 10; attempt++ {
+		d := b.Duration(attempt)
+		require.LessOrEqual(t, d, time.Second)
+		require.GreaterOrEqual(t, d, 50*time.Millisecond)
+	}
+
+	require.LessOrEqual(t, b.Duration(1), 100*time.Millisecond)
+	require.GreaterOrEqual(t, b.Duration(10), 500*time.Millisecond)
+	require.LessOrEqual(t, Backoff{}.Duration(1), DefaultMinBackoff)
+}
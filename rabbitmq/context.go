@@ -0,0 +1,16 @@
+package rabbitmq
+
+import "context"
+
+type deliveryKey struct{}
+
+// ContextWithDelivery returns a copy of ctx that carries d.
+func ContextWithDelivery(ctx context.Context, d Delivery) context.Context {
+	return context.WithValue(ctx, deliveryKey{}, d)
+}
+
+// DeliveryFromContext returns the delivery a Worker attached to a handler context.
+func DeliveryFromContext(ctx context.Context) (Delivery, bool) {
+	d, ok := ctx.Value(deliveryKey{}).(Delivery)
+	return d, ok
+}
@@ -1,7 +1,92 @@
 package rabbitmq
 
+import (
+	"errors"
+	"time"
+)
+
+// ErrDeliveryNotInitialized is returned when a Delivery is settled without an Acknowledger.
+var ErrDeliveryNotInitialized = errors.New("rabbitmq: delivery not initialized")
+
+// Acknowledger settles deliveries on the channel they arrived from.
+type Acknowledger interface {
+	Ack(tag uint64, multiple bool) error
+	Nack(tag uint64, multiple bool, requeue bool) error
+	Reject(tag uint64, requeue bool) error
+}
+
 // Delivery represents a message delivered from the broker.
 type Delivery struct {
-	Body       []byte
-	RoutingKey string
+	Acknowledger Acknowledger // channel the delivery arrived on, nil for AutoAck mocks
+
+	Headers Table // application or headers exchange table
+
+	// Properties
+	ContentType     string    // MIME content type
+	ContentEncoding string    // MIME content encoding
+	DeliveryMode    uint8     // transient (1) or persistent (2)
+	Priority        uint8     // 0 to 9
+	CorrelationID   string    // correlation identifier
+	ReplyTo         string    // address to reply to (ex: RPC)
+	Expiration      string    // message expiration spec
+	MessageID       string    // message identifier
+	Timestamp       time.Time // message timestamp
+	Type            string    // message type name
+	UserID          string    // creating user
+	AppID           string    // creating application
+
+	ConsumerTag string // consumer that received the delivery
+	DeliveryTag uint64 // channel-scoped identifier used to settle the delivery
+	Redelivered bool   // true when the broker delivered this message before
+	Exchange    string // exchange the message was published to
+	RoutingKey  string // routing key the message was published with
+
+	MessageCount uint32 // messages left in the queue, set only by Channel.Get
+
+	Body []byte
+}
+
+// Ack acknowledges the delivery. Only needed when consuming without AutoAck.
+func (d Delivery) Ack() error {
+	if d.Acknowledger == nil {
+		return ErrDeliveryNotInitialized
+	}
+	return d.Acknowledger.Ack(d.DeliveryTag, false)
+}
+
+// Nack negatively acknowledges the delivery, optionally returning it to the queue.
+func (d Delivery) Nack(requeue bool) error {
+	if d.Acknowledger == nil {
+		return ErrDeliveryNotInitialized
+	}
+	return d.Acknowledger.Nack(d.DeliveryTag, false, requeue)
+}
+
+// Reject rejects the delivery, optionally returning it to the queue.
+func (d Delivery) Reject(requeue bool) error {
+	if d.Acknowledger == nil {
+		return ErrDeliveryNotInitialized
+	}
+	return d.Acknowledger.Reject(d.DeliveryTag, requeue)
+}
+
+// Publishing returns the message as a Publishing with the same properties,
+// headers and body, for republishing it.
+func (d Delivery) Publishing() Publishing {
+	return Publishing{
+		Headers:         d.Headers,
+		ContentType:     d.ContentType,
+		ContentEncoding: d.ContentEncoding,
+		DeliveryMode:    d.DeliveryMode,
+		Priority:        d.Priority,
+		CorrelationID:   d.CorrelationID,
+		ReplyTo:         d.ReplyTo,
+		Expiration:      d.Expiration,
+		MessageID:       d.MessageID,
+		Timestamp:       d.Timestamp,
+		Type:            d.Type,
+		UserID:          d.UserID,
+		AppID:           d.AppID,
+		Body:            d.Body,
+	}
 }
@@ -0,0 +1,257 @@
+// Package dlq inspects, replays and purges dead-letter queues.
+//
+// Messages are fetched with basic.get and kept unacknowledged until the
+// operation is done, so every message is seen at most once per call. Use a
+// channel that has no consumers: settling fetched messages may use multiple
+// acknowledgements.
+package dlq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eugene-ruby/xconnect/rabbitmq"
+)
+
+// ErrNoOrigin is returned for messages whose original destination is unknown.
+var ErrNoOrigin = errors.New("dlq: message has no x-death or x-retry-queue header")
+
+// DefaultConfirmTimeout bounds the wait for the broker to confirm each
+// replayed message when ReplayOptions.ConfirmTimeout is zero.
+const DefaultConfirmTimeout = 10 * time.Second
+
+// Death is one entry of the x-death header RabbitMQ adds when it dead-letters a message.
+type Death struct {
+	Queue       string    // queue the message was dead-lettered from
+	Reason      string    // rejected, expired, maxlen or delivery_limit
+	Exchange    string    // exchange the message was published to
+	RoutingKeys []string  // routing keys the message was published with
+	Count       int64     // times the message was dead-lettered for this queue and reason
+	Time        time.Time // first time the message was dead-lettered for this queue and reason
+}
+
+// Message is a dead-lettered message with its death history, most recent first.
+type Message struct {
+	rabbitmq.Delivery
+	Deaths []Death
+}
+
+// Deaths parses the x-death header of d.
+func Deaths(d rabbitmq.Delivery) []Death {
+	entries, _ := d.Headers["x-death"].([]interface{})
+	deaths := make([]Death, 0, len(entries))
+	for _, entry := range entries {
+		table, ok := entry.(rabbitmq.Table)
+		if !ok {
+			continue
+		}
+		death := Death{}
+		death.Queue, _ = table["queue"].(string)
+		death.Reason, _ = table["reason"].(string)
+		death.Exchange, _ = table["exchange"].(string)
+		death.Time, _ = table["time"].(time.Time)
+		switch count := table["count"].(type) {
+		case int64:
+			death.Count = count
+		case int32:
+			death.Count = int64(count)
+		}
+		keys, _ := table["routing-keys"].([]interface{})
+		for _, key := range keys {
+			if s, ok := key.(string); ok {
+				death.RoutingKeys = append(death.RoutingKeys, s)
+			}
+		}
+		deaths = append(deaths, death)
+	}
+	return deaths
+}
+
+// Origin returns where m should go back to. For a message parked by the
+// Worker retry subsystem that is the queue it failed in, through the default
+// exchange; its x-death history only lists the retry queues it went through.
+// Otherwise it is the exchange and first routing key of the most recent death.
+func (m Message) Origin() (exchange, routingKey string, err error) {
+	if queue, ok := m.Headers[rabbitmq.RetryQueueHeader].(string); ok && queue != "" {
+		return "", queue, nil
+	}
+	if len(m.Deaths) > 0 {
+		death := m.Deaths[0]
+		if len(death.RoutingKeys) > 0 {
+			routingKey = death.RoutingKeys[0]
+		}
+		return death.Exchange, routingKey, nil
+	}
+	return "", "", ErrNoOrigin
+}
+
+// Peek returns up to n messages from queue without removing them. The
+// messages are requeued, so their Redelivered flag is set afterwards.
+func Peek(ch rabbitmq.Channel, queue string, n int) ([]Message, error) {
+	var msgs []Message
+	var last rabbitmq.Delivery
+	for len(msgs) < n {
+		d, ok, err := ch.Get(queue, false)
+		if err != nil {
+			return msgs, errors.Join(fmt.Errorf("dlq: get from %s: %w", queue, err), requeue(last))
+		}
+		if !ok {
+			break
+		}
+		msgs = append(msgs, Message{Delivery: d, Deaths: Deaths(d)})
+		last = d
+	}
+	return msgs, requeue(last)
+}
+
+// ReplayOptions selects and rewrites the messages Replay republishes.
+type ReplayOptions struct {
+	// Limit caps the number of messages replayed. Zero replays every message.
+	Limit int
+	// Filter selects the messages to replay. Messages it rejects stay in the
+	// queue. Nil selects every message.
+	Filter func(m Message) bool
+	// Rewrite may change the destination and contents of a message before it
+	// is republished. req starts with the message's origin. A message without
+	// an origin is replayed only when Rewrite gives it a routing key.
+	Rewrite func(m Message, req *rabbitmq.PublishRequest)
+
+	// Publisher republishes the messages. When nil, Replay puts ch into
+	// confirm mode and creates one, so a channel that is already in confirm
+	// mode, for example from an earlier Replay, needs its ConfirmPublisher
+	// passed here.
+	Publisher *rabbitmq.ConfirmPublisher
+	// ConfirmTimeout bounds the wait for each confirmation. Defaults to
+	// DefaultConfirmTimeout.
+	ConfirmTimeout time.Duration
+}
+
+// ReplayResult counts the messages a Replay call handled.
+type ReplayResult struct {
+	Replayed int // republished and removed from the queue
+	Skipped  int // left in the queue by Filter, for lack of a destination, or as unroutable
+}
+
+// Replay republishes the messages of queue to their origin and removes them
+// from queue. Only messages in the queue when Replay starts are considered,
+// so a replayed message that dead-letters again is not replayed twice. The
+// retry headers set by the Worker are removed so replayed messages get a
+// fresh set of attempts.
+//
+// Messages are published mandatory and acked only once the broker confirms
+// them. Messages the broker returns as unroutable stay in the queue and are
+// counted as skipped; any other publish failure stops the replay.
+func Replay(ch rabbitmq.Channel, queue string, opts ReplayOptions) (ReplayResult, error) {
+	var result ReplayResult
+	pub := opts.Publisher
+	if pub == nil {
+		var err error
+		if pub, err = rabbitmq.NewConfirmPublisher(ch, rabbitmq.ConfirmConfig{Mandatory: true}); err != nil {
+			return result, fmt.Errorf("dlq: %w", err)
+		}
+	}
+	timeout := opts.ConfirmTimeout
+	if timeout <= 0 {
+		timeout = DefaultConfirmTimeout
+	}
+
+	var skipped []rabbitmq.Delivery
+	finish := func(err error) (ReplayResult, error) {
+		result.Skipped = len(skipped)
+		// Requeue newest first so the skipped messages keep their order.
+		for i := len(skipped) - 1; i >= 0; i-- {
+			err = errors.Join(err, skipped[i].Nack(true))
+		}
+		return result, err
+	}
+
+	remaining := -1
+	for remaining != 0 && (opts.Limit <= 0 || result.Replayed < opts.Limit) {
+		d, ok, err := ch.Get(queue, false)
+		if err != nil {
+			return finish(fmt.Errorf("dlq: get from %s: %w", queue, err))
+		}
+		if !ok {
+			break
+		}
+		if remaining < 0 {
+			remaining = int(d.MessageCount) + 1
+		}
+		remaining--
+
+		m := Message{Delivery: d, Deaths: Deaths(d)}
+		if opts.Filter != nil && !opts.Filter(m) {
+			skipped = append(skipped, d)
+			continue
+		}
+		req, originErr := replayRequest(m)
+		if opts.Rewrite != nil {
+			opts.Rewrite(m, req)
+		}
+		if req.RoutingKey == "" && (originErr != nil || req.Exchange == "") {
+			skipped = append(skipped, d)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		err = pub.PublishWithOptions(ctx, req.Exchange, req.RoutingKey, true, req.Immediate, req.Publishing)
+		cancel()
+		if errors.Is(err, rabbitmq.ErrUnroutable) {
+			skipped = append(skipped, d)
+			continue
+		}
+		if err != nil {
+			skipped = append(skipped, d)
+			return finish(fmt.Errorf("dlq: replay message %d: %w", d.DeliveryTag, err))
+		}
+		if err := d.Ack(); err != nil {
+			return finish(fmt.Errorf("dlq: ack message %d: %w", d.DeliveryTag, err))
+		}
+		result.Replayed++
+	}
+	return finish(nil)
+}
+
+// Purge removes every message from queue and returns how many were removed.
+func Purge(ch rabbitmq.Channel, queue string) (int, error) {
+	n, err := ch.QueuePurge(queue, false)
+	if err != nil {
+		return 0, fmt.Errorf("dlq: purge %s: %w", queue, err)
+	}
+	return n, nil
+}
+
+// replayRequest builds the publish that sends m back to its origin. It
+// returns an empty destination and ErrNoOrigin when the origin is unknown.
+// UserID is cleared: the broker refuses a user-id that differs from the
+// user of the replaying connection.
+func replayRequest(m Message) (*rabbitmq.PublishRequest, error) {
+	pub := m.Publishing()
+	pub.UserID = ""
+	if len(pub.Headers) > 0 {
+		headers := make(rabbitmq.Table, len(pub.Headers))
+		for k, v := range pub.Headers {
+			headers[k] = v
+		}
+		delete(headers, rabbitmq.RetryCountHeader)
+		delete(headers, rabbitmq.RetryErrorHeader)
+		pub.Headers = headers
+	}
+
+	exchange, routingKey, err := m.Origin()
+	return &rabbitmq.PublishRequest{
+		Exchange:   exchange,
+		RoutingKey: routingKey,
+		Publishing: pub,
+	}, err
+}
+
+// requeue returns every message fetched up to and including last to the queue.
+func requeue(last rabbitmq.Delivery) error {
+	if last.Acknowledger == nil {
+		return nil
+	}
+	return last.Acknowledger.Nack(last.DeliveryTag, true, true)
+}
@@ -0,0 +1,239 @@
+package dlq_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/eugene-ruby/xconnect/rabbitmq"
+	"github.com/eugene-ruby/xconnect/rabbitmq/dlq"
+	"github.com/eugene-ruby/xconnect/rabbitmq/memory"
+	"github.com/eugene-ruby/xconnect/rabbitmq/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+// confirmingMock returns a MockChannel that acks every publish made in confirm mode.
+func confirmingMock() *mocks.MockChannel {
+	mock := mocks.NewMockChannel()
+	mock.ConfirmFunc = func(mocks.PublishedMessage) bool { return true }
+	return mock
+}
+
+func deadLettered(id, exchange, key string) rabbitmq.Delivery {
+	return rabbitmq.Delivery{
+		MessageID: id,
+		Headers: rabbitmq.Table{
+			"x-death": []interface{}{
+				rabbitmq.Table{
+					"queue":        "orders",
+					"reason":       "rejected",
+					"exchange":     exchange,
+					"routing-keys": []interface{}{key},
+					"count":        int64(2),
+					"time":         time.Date(2025, 4, 26, 16, 52, 0, 0, time.UTC),
+				},
+			},
+		},
+		Body: []byte(id),
+	}
+}
+
+func TestDeaths(t *testing.T) {
+	deaths := dlq.Deaths(deadLettered("1", "shop", "order.created"))
+
+	require.Equal(t, []dlq.Death{{
+		Queue:       "orders",
+		Reason:      "rejected",
+		Exchange:    "shop",
+		RoutingKeys: []string{"order.created"},
+		Count:       2,
+		Time:        time.Date(2025, 4, 26, 16, 52, 0, 0, time.UTC),
+	}}, deaths)
+	require.Empty(t, dlq.Deaths(rabbitmq.Delivery{}))
+}
+
+func TestPeek_LeavesMessagesInQueue(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	mock.GetMessages = map[string][]rabbitmq.Delivery{
+		"orders.dlq": {deadLettered("1", "shop", "a"), deadLettered("2", "shop", "b"), deadLettered("3", "shop", "c")},
+	}
+
+	msgs, err := dlq.Peek(mock, "orders.dlq", 2)
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	require.Equal(t, "1", msgs[0].MessageID)
+	require.Equal(t, "shop", msgs[1].Deaths[0].Exchange)
+
+	require.Len(t, mock.GetMessages["orders.dlq"], 3)
+	require.Equal(t, "1", mock.GetMessages["orders.dlq"][0].MessageID)
+}
+
+func TestReplay(t *testing.T) {
+	parked := rabbitmq.Delivery{
+		MessageID: "parked",
+		UserID:    "billing",
+		Headers: rabbitmq.Table{
+			rabbitmq.RetryQueueHeader: "orders",
+			rabbitmq.RetryCountHeader: int64(3),
+			rabbitmq.RetryErrorHeader: "boom",
+			"tenant":                  "acme",
+		},
+	}
+	mock := confirmingMock()
+	mock.GetMessages = map[string][]rabbitmq.Delivery{
+		"orders.dlq": {deadLettered("1", "shop", "order.created"), deadLettered("skip", "shop", "x"), parked, {MessageID: "orphan"}},
+	}
+
+	result, err := dlq.Replay(mock, "orders.dlq", dlq.ReplayOptions{
+		Filter: func(m dlq.Message) bool { return m.MessageID != "skip" },
+	})
+	require.NoError(t, err)
+	require.Equal(t, dlq.ReplayResult{Replayed: 2, Skipped: 2}, result)
+
+	require.Len(t, mock.PublishedMessages, 2)
+	require.Equal(t, "shop", mock.PublishedMessages[0].Exchange)
+	require.Equal(t, "order.created", mock.PublishedMessages[0].RoutingKey)
+	require.Equal(t, "", mock.PublishedMessages[1].Exchange)
+	require.Equal(t, "orders", mock.PublishedMessages[1].RoutingKey)
+	require.Equal(t, rabbitmq.Table{rabbitmq.RetryQueueHeader: "orders", "tenant": "acme"}, mock.PublishedMessages[1].Publishing.Headers)
+	require.Empty(t, mock.PublishedMessages[1].Publishing.UserID)
+	require.True(t, mock.PublishedMessages[0].Mandatory)
+
+	left := mock.GetMessages["orders.dlq"]
+	require.Len(t, left, 2)
+	require.Equal(t, "skip", left[0].MessageID)
+	require.Equal(t, "orphan", left[1].MessageID)
+}
+
+func TestReplay_LimitAndRewrite(t *testing.T) {
+	mock := confirmingMock()
+	mock.GetMessages = map[string][]rabbitmq.Delivery{
+		"orders.dlq": {deadLettered("1", "shop", "a"), deadLettered("2", "shop", "b")},
+	}
+
+	result, err := dlq.Replay(mock, "orders.dlq", dlq.ReplayOptions{
+		Limit: 1,
+		Rewrite: func(m dlq.Message, req *rabbitmq.PublishRequest) {
+			req.Exchange = "shop.v2"
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Replayed)
+	require.Equal(t, "shop.v2", mock.PublishedMessages[0].Exchange)
+	require.Equal(t, "a", mock.PublishedMessages[0].RoutingKey)
+	require.Len(t, mock.GetMessages["orders.dlq"], 1)
+}
+
+func TestReplay_PublishError(t *testing.T) {
+	mock := confirmingMock()
+	mock.PublishErr = errors.New("channel closed")
+	mock.GetMessages = map[string][]rabbitmq.Delivery{
+		"orders.dlq": {deadLettered("1", "shop", "a")},
+	}
+
+	_, err := dlq.Replay(mock, "orders.dlq", dlq.ReplayOptions{})
+	require.ErrorContains(t, err, "channel closed")
+	require.Len(t, mock.GetMessages["orders.dlq"], 1)
+}
+
+func TestReplay_SkipsMessagesWithoutDestination(t *testing.T) {
+	mock := confirmingMock()
+	mock.GetMessages = map[string][]rabbitmq.Delivery{
+		"orders.dlq": {{MessageID: "orphan"}, {MessageID: "keyed"}},
+	}
+
+	result, err := dlq.Replay(mock, "orders.dlq", dlq.ReplayOptions{
+		Rewrite: func(m dlq.Message, req *rabbitmq.PublishRequest) {
+			req.Exchange = "shop"
+			if m.MessageID == "keyed" {
+				req.RoutingKey = "order.created"
+			}
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, dlq.ReplayResult{Replayed: 1, Skipped: 1}, result)
+	require.Len(t, mock.Published(), 1)
+	require.Equal(t, "order.created", mock.Published()[0].RoutingKey)
+	require.Equal(t, "orphan", mock.GetMessages["orders.dlq"][0].MessageID)
+}
+
+func TestReplay_AcksOnlyConfirmedMessages(t *testing.T) {
+	mock := confirmingMock()
+	mock.ReturnFunc = func(msg mocks.PublishedMessage) bool { return msg.RoutingKey == "gone" }
+	mock.GetMessages = map[string][]rabbitmq.Delivery{
+		"orders.dlq": {deadLettered("unroutable", "shop", "gone"), deadLettered("routed", "shop", "order.created")},
+	}
+
+	result, err := dlq.Replay(mock, "orders.dlq", dlq.ReplayOptions{})
+	require.NoError(t, err)
+	require.Equal(t, dlq.ReplayResult{Replayed: 1, Skipped: 1}, result)
+	require.Len(t, mock.GetMessages["orders.dlq"], 1)
+	require.Equal(t, "unroutable", mock.GetMessages["orders.dlq"][0].MessageID)
+
+	nacking := mocks.NewMockChannel()
+	nacking.ConfirmFunc = func(mocks.PublishedMessage) bool { return false }
+	nacking.GetMessages = map[string][]rabbitmq.Delivery{"orders.dlq": {deadLettered("1", "shop", "a")}}
+	_, err = dlq.Replay(nacking, "orders.dlq", dlq.ReplayOptions{})
+	require.ErrorIs(t, err, rabbitmq.ErrNacked)
+	require.Len(t, nacking.GetMessages["orders.dlq"], 1)
+
+	silent := mocks.NewMockChannel()
+	silent.GetMessages = map[string][]rabbitmq.Delivery{"orders.dlq": {deadLettered("1", "shop", "a")}}
+	_, err = dlq.Replay(silent, "orders.dlq", dlq.ReplayOptions{ConfirmTimeout: 10 * time.Millisecond})
+	require.ErrorIs(t, err, rabbitmq.ErrConfirmTimeout)
+	require.Len(t, silent.GetMessages["orders.dlq"], 1)
+}
+
+func TestReplay_RetryParkedMessageReturnsToItsQueue(t *testing.T) {
+	broker := memory.NewBroker()
+	ch := broker.Channel()
+	require.NoError(t, ch.ExchangeDeclare("shop", rabbitmq.ExchangeTopic, true, false, false, false, nil))
+
+	worker := rabbitmq.NewWorker(ch, rabbitmq.WorkerConfig{
+		Queue:   "orders",
+		Declare: true, BindExchange: "shop", BindRoutingKey: "order.*",
+		Retry:   &rabbitmq.RetryConfig{Delays: []time.Duration{5 * time.Millisecond}, MaxAttempts: 2},
+		Handler: func(rabbitmq.Delivery) error { return errors.New("boom") },
+	})
+	require.NoError(t, worker.Start(context.Background()))
+	require.NoError(t, ch.PublishWithOptions("shop", "order.created", false, false, rabbitmq.Publishing{UserID: "billing", Body: []byte("order")}))
+	require.Eventually(t, func() bool {
+		q, err := ch.QueueInspect("orders.dlq")
+		return err == nil && q.Messages == 1
+	}, time.Second, time.Millisecond)
+	require.NoError(t, worker.Shutdown(context.Background()))
+
+	msgs, err := dlq.Peek(ch, "orders.dlq", 1)
+	require.NoError(t, err)
+	require.Equal(t, "orders.retry.5ms", msgs[0].Deaths[0].Queue, "x-death only knows the retry queue")
+	require.Equal(t, "shop", msgs[0].Headers[rabbitmq.RetryExchangeHeader])
+	require.Equal(t, "order.created", msgs[0].Headers[rabbitmq.RetryRoutingKeyHeader])
+	exchange, key, err := msgs[0].Origin()
+	require.NoError(t, err)
+	require.Equal(t, "", exchange)
+	require.Equal(t, "orders", key)
+
+	result, err := dlq.Replay(broker.Channel(), "orders.dlq", dlq.ReplayOptions{})
+	require.NoError(t, err)
+	require.Equal(t, dlq.ReplayResult{Replayed: 1}, result)
+
+	replayed, ok, err := ch.Get("orders", true)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "order", string(replayed.Body))
+	require.Nil(t, replayed.Headers[rabbitmq.RetryCountHeader])
+	q, err := ch.QueueInspect("orders.retry.5ms")
+	require.NoError(t, err)
+	require.Zero(t, q.Messages)
+}
+
+func TestPurge(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	mock.GetMessages = map[string][]rabbitmq.Delivery{"orders.dlq": {{}, {}}}
+
+	n, err := dlq.Purge(mock, "orders.dlq")
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	require.Empty(t, mock.GetMessages["orders.dlq"])
+}
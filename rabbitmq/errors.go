@@ -0,0 +1,47 @@
+package rabbitmq
+
+import "errors"
+
+// permanentError marks a handler error that must not be retried.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// requeueError marks a handler error that should be retried by requeueing the message.
+type requeueError struct {
+	err error
+}
+
+func (e *requeueError) Error() string { return e.err.Error() }
+func (e *requeueError) Unwrap() error { return e.err }
+
+// Permanent wraps err so that the Worker rejects the message without requeueing it.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Requeue wraps err so that the Worker nacks the message and returns it to the queue.
+func Requeue(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &requeueError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var target *permanentError
+	return errors.As(err, &target)
+}
+
+// IsRequeue reports whether err was marked with Requeue.
+func IsRequeue(err error) bool {
+	var target *requeueError
+	return errors.As(err, &target)
+}
@@ -0,0 +1,278 @@
+// Package memory provides an in-process AMQP broker for tests. Its channels
+// implement rabbitmq.Channel and route, queue, deliver, expire and dead-letter
+// messages the way RabbitMQ does, so code using Workers, Publishers and
+// topologies can be exercised without a running server.
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/eugene-ruby/xconnect/internal/topic"
+	"github.com/eugene-ruby/xconnect/rabbitmq"
+)
+
+var (
+	// ErrNotFound is returned for operations on exchanges or queues that do not exist.
+	ErrNotFound = errors.New("memory: not found")
+	// ErrAccessRefused is returned for operations RabbitMQ forbids, such as
+	// binding the default exchange, declaring "amq." names or consuming a
+	// queue in exclusive use.
+	ErrAccessRefused = errors.New("memory: access refused")
+)
+
+// DirectReplyTo is the pseudo-queue a channel consumes to receive replies
+// addressed to it through the ReplyTo property.
+const DirectReplyTo = "amq.rabbitmq.reply-to"
+
+// Broker holds the exchanges and queues shared by its channels. Its zero
+// value is not usable; create one with NewBroker.
+type Broker struct {
+	mu        sync.Mutex
+	exchanges map[string]*exchange
+	queues    map[string]*queue
+	seq       uint64 // source of generated names and channel ids
+}
+
+// NewBroker returns a broker with the default exchange and the predeclared
+// amq.direct, amq.fanout, amq.topic, amq.headers and amq.match exchanges.
+func NewBroker() *Broker {
+	b := &Broker{
+		exchanges: make(map[string]*exchange),
+		queues:    make(map[string]*queue),
+	}
+	for name, kind := range map[string]string{
+		"":            rabbitmq.ExchangeDirect,
+		"amq.direct":  rabbitmq.ExchangeDirect,
+		"amq.fanout":  rabbitmq.ExchangeFanout,
+		"amq.topic":   rabbitmq.ExchangeTopic,
+		"amq.headers": rabbitmq.ExchangeHeaders,
+		"amq.match":   rabbitmq.ExchangeHeaders,
+	} {
+		b.exchanges[name] = &exchange{name: name, kind: kind, durable: true}
+	}
+	return b
+}
+
+// Channel opens a new channel on the broker.
+func (b *Broker) Channel() *Channel {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return &Channel{
+		broker:    b,
+		id:        b.next(),
+		unacked:   make(map[uint64]*unacked),
+		consumers: make(map[string]*consumer),
+	}
+}
+
+// next returns a broker-wide sequence number. Called with b.mu held.
+func (b *Broker) next() uint64 {
+	b.seq++
+	return b.seq
+}
+
+// exchange is a declared exchange and the bindings it routes through.
+type exchange struct {
+	name       string
+	kind       string
+	durable    bool
+	autoDelete bool
+	internal   bool
+	args       rabbitmq.Table
+	bindings   []binding
+}
+
+// binding routes messages of an exchange to a queue or another exchange.
+type binding struct {
+	destination string
+	toExchange  bool
+	key         string
+	args        rabbitmq.Table
+}
+
+func (b binding) equal(other binding) bool {
+	return b.destination == other.destination && b.toExchange == other.toExchange &&
+		b.key == other.key && tablesEqual(b.args, other.args)
+}
+
+func (e *exchange) bind(b binding) {
+	for _, existing := range e.bindings {
+		if existing.equal(b) {
+			return
+		}
+	}
+	e.bindings = append(e.bindings, b)
+}
+
+func (e *exchange) unbind(match func(binding) bool) {
+	kept := e.bindings[:0]
+	for _, b := range e.bindings {
+		if !match(b) {
+			kept = append(kept, b)
+		}
+	}
+	e.bindings = kept
+}
+
+// predeclared reports whether the exchange is reserved by the broker.
+func (e *exchange) predeclared() bool {
+	return e.name == "" || strings.HasPrefix(e.name, "amq.")
+}
+
+// unbindAll removes every binding whose destination is name, deleting
+// auto-delete exchanges left without bindings. Called with b.mu held.
+func (b *Broker) unbindAll(name string, toExchange bool) {
+	for _, e := range b.exchanges {
+		before := len(e.bindings)
+		e.unbind(func(bd binding) bool { return bd.destination == name && bd.toExchange == toExchange })
+		b.autoDeleteExchange(e, before)
+	}
+}
+
+// autoDeleteExchange deletes e when it is auto-delete and lost its last
+// binding. Called with b.mu held.
+func (b *Broker) autoDeleteExchange(e *exchange, bindingsBefore int) {
+	if e.autoDelete && bindingsBefore > 0 && len(e.bindings) == 0 {
+		delete(b.exchanges, e.name)
+		b.unbindAll(e.name, true)
+	}
+}
+
+// route returns the queues a message published to ex with key and headers
+// reaches, following exchange-to-exchange bindings. Called with b.mu held.
+func (b *Broker) route(ex *exchange, key string, headers rabbitmq.Table) []*queue {
+	var queues []*queue
+	seen := make(map[*queue]bool)
+	visited := make(map[*exchange]bool)
+
+	var walk func(e *exchange)
+	walk = func(e *exchange) {
+		if visited[e] {
+			return
+		}
+		visited[e] = true
+		if e.name == "" {
+			if q, ok := b.queues[key]; ok && !seen[q] {
+				seen[q] = true
+				queues = append(queues, q)
+			}
+			return
+		}
+		for _, bd := range e.bindings {
+			if !e.matches(bd, key, headers) {
+				continue
+			}
+			if bd.toExchange {
+				if dest, ok := b.exchanges[bd.destination]; ok {
+					walk(dest)
+				}
+			} else if q, ok := b.queues[bd.destination]; ok && !seen[q] {
+				seen[q] = true
+				queues = append(queues, q)
+			}
+		}
+	}
+	walk(ex)
+	return queues
+}
+
+// matches reports whether a message with key and headers follows bd.
+func (e *exchange) matches(bd binding, key string, headers rabbitmq.Table) bool {
+	switch e.kind {
+	case rabbitmq.ExchangeFanout:
+		return true
+	case rabbitmq.ExchangeTopic:
+		return topic.Match(bd.key, key)
+	case rabbitmq.ExchangeHeaders:
+		return matchHeaders(bd.args, headers)
+	default:
+		return bd.key == key
+	}
+}
+
+// matchHeaders implements the headers exchange: x-match "all" (the default)
+// requires every binding argument to match, "any" at least one. Arguments
+// starting with "x-" are ignored unless x-match ends with "-with-x".
+func matchHeaders(args, headers rabbitmq.Table) bool {
+	mode, _ := args["x-match"].(string)
+	anyMatch := strings.HasPrefix(mode, "any")
+	withX := strings.HasSuffix(mode, "-with-x")
+	for k, want := range args {
+		if k == "x-match" || (strings.HasPrefix(k, "x-") && !withX) {
+			continue
+		}
+		got, ok := headers[k]
+		matched := ok && (want == nil || valuesEqual(got, want))
+		if matched && anyMatch {
+			return true
+		}
+		if !matched && !anyMatch {
+			return false
+		}
+	}
+	return !anyMatch
+}
+
+// valuesEqual compares table values, treating integers of any size alike.
+func valuesEqual(a, b interface{}) bool {
+	if x, ok := toInt64(a); ok {
+		y, ok := toInt64(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func tablesEqual(a, b rabbitmq.Table) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		w, ok := b[k]
+		if !ok || !valuesEqual(v, w) {
+			return false
+		}
+	}
+	return true
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	default:
+		return 0, false
+	}
+}
+
+func copyTable(t rabbitmq.Table) rabbitmq.Table {
+	if t == nil {
+		return nil
+	}
+	out := make(rabbitmq.Table, len(t))
+	for k, v := range t {
+		out[k] = v
+	}
+	return out
+}
+
+func preconditionFailed(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", rabbitmq.ErrPreconditionFailed, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,773 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/eugene-ruby/xconnect/rabbitmq"
+)
+
+// Channel is a channel on a Broker. It implements rabbitmq.Channel and is
+// the Acknowledger of the deliveries it hands out.
+//
+// Unlike RabbitMQ, errors such as ErrPreconditionFailed leave the channel open.
+type Channel struct {
+	broker *Broker
+	id     uint64
+
+	// Guarded by broker.mu.
+	closed     bool
+	tag        uint64 // last delivery tag
+	unacked    map[uint64]*unacked
+	consumers  map[string]*consumer
+	prefetch   int
+	global     bool
+	confirming bool
+	published  uint64 // last publish sequence number in confirm mode
+	replyQueue *queue // direct reply-to pseudo-queue
+
+	// publishMu serializes publishes, from sequence number to notifications,
+	// so that confirms reach listeners in delivery tag order.
+	publishMu sync.Mutex
+
+	notifyMu     sync.Mutex
+	notifyClosed bool
+	confirms     []chan rabbitmq.Confirmation
+	returns      []chan rabbitmq.Return
+}
+
+// unacked is a message delivered without autoAck and not settled yet.
+type unacked struct {
+	queue    *queue
+	msg      *message
+	consumer *consumer // nil for messages fetched with Get
+}
+
+// consumer receives a queue's messages one at a time on its own goroutine.
+type consumer struct {
+	tag      string
+	ch       *Channel
+	queue    *queue
+	autoAck  bool
+	prefetch int // per-consumer limit of unacked messages, zero for none
+
+	busy      bool // a delivery is on its way to out
+	unacked   int
+	cancelled bool
+
+	next chan inflight // holds the delivery being handed to out
+	out  chan rabbitmq.Delivery
+	done chan struct{}
+}
+
+type inflight struct {
+	delivery rabbitmq.Delivery
+	msg      *message
+}
+
+// ready reports whether c can take another message. Called with b.mu held.
+func (c *consumer) ready() bool {
+	if c.busy || c.cancelled {
+		return false
+	}
+	if c.autoAck {
+		return true
+	}
+	if c.ch.global && c.ch.prefetch > 0 {
+		return len(c.ch.unacked) < c.ch.prefetch
+	}
+	return c.prefetch == 0 || c.unacked < c.prefetch
+}
+
+// deliver assigns m to c and passes it to the consumer goroutine. Called with b.mu held.
+func (c *consumer) deliver(m *message) {
+	c.ch.tag++
+	d := m.delivery()
+	d.ConsumerTag = c.tag
+	d.DeliveryTag = c.ch.tag
+	d.Acknowledger = c.ch
+	if !c.autoAck {
+		c.ch.unacked[d.DeliveryTag] = &unacked{queue: c.queue, msg: m, consumer: c}
+		c.unacked++
+	}
+	c.busy = true
+	c.next <- inflight{delivery: d, msg: m}
+}
+
+// run forwards deliveries to out until the consumer is cancelled, then
+// returns a delivery that never reached out to the queue and closes out.
+func (c *consumer) run() {
+	defer close(c.out)
+	b := c.ch.broker
+	for {
+		select {
+		case f := <-c.next:
+			select {
+			case c.out <- f.delivery:
+				b.mu.Lock()
+				c.busy = false
+				c.queue.dispatch()
+				b.mu.Unlock()
+			case <-c.done:
+				b.mu.Lock()
+				c.restore(f)
+				b.mu.Unlock()
+				return
+			}
+		case <-c.done:
+			b.mu.Lock()
+			select {
+			case f := <-c.next:
+				c.restore(f)
+			default:
+			}
+			b.mu.Unlock()
+			return
+		}
+	}
+}
+
+// restore puts back a message that was assigned to c but never delivered.
+// Called with b.mu held.
+func (c *consumer) restore(f inflight) {
+	if !c.autoAck {
+		if _, ok := c.ch.unacked[f.delivery.DeliveryTag]; !ok {
+			return // already requeued by Channel.Close
+		}
+		delete(c.ch.unacked, f.delivery.DeliveryTag)
+	}
+	c.queue.requeue(f.msg)
+}
+
+// cancel stops c and deletes its queue when it was the last consumer of an
+// auto-delete queue. Called with b.mu held.
+func (c *consumer) cancel() {
+	if c.cancelled {
+		return
+	}
+	c.cancelled = true
+	close(c.done)
+	delete(c.ch.consumers, c.tag)
+	q := c.queue
+	if i := slices.Index(q.consumers, c); i >= 0 {
+		q.consumers = slices.Delete(q.consumers, i, i+1)
+	}
+	if q.exclusiveTo == c {
+		q.exclusiveTo = nil
+	}
+	if q.autoDelete && !q.deleted && len(q.consumers) == 0 {
+		q.remove()
+	}
+}
+
+// lock acquires the broker lock, failing when the channel is closed.
+func (c *Channel) lock() error {
+	c.broker.mu.Lock()
+	if c.closed {
+		c.broker.mu.Unlock()
+		return rabbitmq.ErrClosed
+	}
+	return nil
+}
+
+func (c *Channel) unlock() { c.broker.mu.Unlock() }
+
+func (c *Channel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args rabbitmq.Table) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	b := c.broker
+
+	if e, ok := b.exchanges[name]; ok {
+		if e.kind != kind || e.durable != durable || e.autoDelete != autoDelete || e.internal != internal || !tablesEqual(e.args, args) {
+			return preconditionFailed("inequivalent arguments for exchange %q", name)
+		}
+		return nil
+	}
+	if name == "" || strings.HasPrefix(name, "amq.") {
+		return fmt.Errorf("%w: exchange name %q is reserved", ErrAccessRefused, name)
+	}
+	switch kind {
+	case rabbitmq.ExchangeDirect, rabbitmq.ExchangeFanout, rabbitmq.ExchangeTopic, rabbitmq.ExchangeHeaders:
+	default:
+		return fmt.Errorf("memory: unknown exchange kind %q", kind)
+	}
+	b.exchanges[name] = &exchange{
+		name:       name,
+		kind:       kind,
+		durable:    durable,
+		autoDelete: autoDelete,
+		internal:   internal,
+		args:       copyTable(args),
+	}
+	return nil
+}
+
+func (c *Channel) ExchangeDelete(name string, ifUnused, noWait bool) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	b := c.broker
+
+	e, ok := b.exchanges[name]
+	if !ok {
+		return nil
+	}
+	if e.predeclared() {
+		return fmt.Errorf("%w: exchange %q is reserved", ErrAccessRefused, name)
+	}
+	if ifUnused && len(e.bindings) > 0 {
+		return preconditionFailed("exchange %q in use", name)
+	}
+	delete(b.exchanges, name)
+	b.unbindAll(name, true)
+	return nil
+}
+
+// exchangePair looks up the source and destination of an exchange binding.
+// Called with b.mu held.
+func (c *Channel) exchangePair(source, destination string) (*exchange, *exchange, error) {
+	src, ok := c.broker.exchanges[source]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: exchange %q", ErrNotFound, source)
+	}
+	dst, ok := c.broker.exchanges[destination]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: exchange %q", ErrNotFound, destination)
+	}
+	if source == "" || destination == "" {
+		return nil, nil, fmt.Errorf("%w: the default exchange cannot be bound", ErrAccessRefused)
+	}
+	return src, dst, nil
+}
+
+func (c *Channel) ExchangeBind(destination, key, source string, noWait bool, args rabbitmq.Table) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	src, _, err := c.exchangePair(source, destination)
+	if err != nil {
+		return err
+	}
+	src.bind(binding{destination: destination, toExchange: true, key: key, args: copyTable(args)})
+	return nil
+}
+
+func (c *Channel) ExchangeUnbind(destination, key, source string, noWait bool, args rabbitmq.Table) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	src, _, err := c.exchangePair(source, destination)
+	if err != nil {
+		return err
+	}
+	before := len(src.bindings)
+	target := binding{destination: destination, toExchange: true, key: key, args: args}
+	src.unbind(target.equal)
+	c.broker.autoDeleteExchange(src, before)
+	return nil
+}
+
+func (c *Channel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args rabbitmq.Table) (rabbitmq.Queue, error) {
+	if err := c.lock(); err != nil {
+		return rabbitmq.Queue{}, err
+	}
+	defer c.unlock()
+	b := c.broker
+
+	if name == "" {
+		name = fmt.Sprintf("amq.gen-%d", b.next())
+	} else if q, ok := b.queues[name]; ok {
+		if q.owner != nil && q.owner != c {
+			return rabbitmq.Queue{}, fmt.Errorf("%w: queue %q is exclusive to another channel", ErrAccessRefused, name)
+		}
+		if q.durable != durable || q.autoDelete != autoDelete || q.exclusive != exclusive || !tablesEqual(q.args, args) {
+			return rabbitmq.Queue{}, preconditionFailed("inequivalent arguments for queue %q", name)
+		}
+		return q.info(), nil
+	} else if strings.HasPrefix(name, "amq.") {
+		return rabbitmq.Queue{}, fmt.Errorf("%w: queue name %q is reserved", ErrAccessRefused, name)
+	}
+
+	q := newQueue(b, name, durable, autoDelete, exclusive, args)
+	if exclusive {
+		q.owner = c
+	}
+	b.queues[name] = q
+	return q.info(), nil
+}
+
+// queue looks up a queue by name. Called with b.mu held.
+func (c *Channel) queue(name string) (*queue, error) {
+	q, ok := c.broker.queues[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: queue %q", ErrNotFound, name)
+	}
+	if q.owner != nil && q.owner != c {
+		return nil, fmt.Errorf("%w: queue %q is exclusive to another channel", ErrAccessRefused, name)
+	}
+	return q, nil
+}
+
+// QueueInspect reports the ready messages and consumers of an existing queue.
+func (c *Channel) QueueInspect(name string) (rabbitmq.Queue, error) {
+	if err := c.lock(); err != nil {
+		return rabbitmq.Queue{}, err
+	}
+	defer c.unlock()
+
+	q, err := c.queue(name)
+	if err != nil {
+		return rabbitmq.Queue{}, err
+	}
+	q.expire()
+	return q.info(), nil
+}
+
+func (c *Channel) QueueBind(name, key, exchange string, noWait bool, args rabbitmq.Table) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	e, err := c.bindable(name, exchange)
+	if err != nil {
+		return err
+	}
+	e.bind(binding{destination: name, key: key, args: copyTable(args)})
+	return nil
+}
+
+func (c *Channel) QueueUnbind(name, key, exchange string, args rabbitmq.Table) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	e, err := c.bindable(name, exchange)
+	if err != nil {
+		return err
+	}
+	before := len(e.bindings)
+	target := binding{destination: name, key: key, args: args}
+	e.unbind(target.equal)
+	c.broker.autoDeleteExchange(e, before)
+	return nil
+}
+
+// bindable looks up the exchange of a queue binding. Called with b.mu held.
+func (c *Channel) bindable(queue, exchange string) (*exchange, error) {
+	if _, err := c.queue(queue); err != nil {
+		return nil, err
+	}
+	e, ok := c.broker.exchanges[exchange]
+	if !ok {
+		return nil, fmt.Errorf("%w: exchange %q", ErrNotFound, exchange)
+	}
+	if exchange == "" {
+		return nil, fmt.Errorf("%w: the default exchange cannot be bound", ErrAccessRefused)
+	}
+	return e, nil
+}
+
+func (c *Channel) QueueDelete(name string, ifUnused, ifEmpty, noWait bool) (int, error) {
+	if err := c.lock(); err != nil {
+		return 0, err
+	}
+	defer c.unlock()
+
+	q, ok := c.broker.queues[name]
+	if !ok {
+		return 0, nil
+	}
+	if ifUnused && len(q.consumers) > 0 {
+		return 0, preconditionFailed("queue %q in use", name)
+	}
+	if ifEmpty && len(q.messages) > 0 {
+		return 0, preconditionFailed("queue %q not empty", name)
+	}
+	return q.remove(), nil
+}
+
+// QueuePurge removes the ready messages of a queue. Unacknowledged messages stay.
+func (c *Channel) QueuePurge(name string, noWait bool) (int, error) {
+	if err := c.lock(); err != nil {
+		return 0, err
+	}
+	defer c.unlock()
+
+	q, err := c.queue(name)
+	if err != nil {
+		return 0, err
+	}
+	n := len(q.messages)
+	q.messages = nil
+	return n, nil
+}
+
+func (c *Channel) Publish(exchange, routingKey string, body []byte) error {
+	return c.PublishWithOptions(exchange, routingKey, false, false, rabbitmq.Publishing{
+		ContentType: "application/octet-stream",
+		Body:        body,
+	})
+}
+
+func (c *Channel) PublishWithContext(ctx context.Context, exchange, routingKey string, mandatory, immediate bool, msg rabbitmq.Publishing) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.PublishWithOptions(exchange, routingKey, mandatory, immediate, msg)
+}
+
+// PublishWithOptions routes msg to every matching queue. Mandatory messages
+// that reach no queue are sent to NotifyReturn listeners, and in confirm mode
+// every publish is confirmed; it is nacked when a full queue with the
+// reject-publish overflow refused it.
+func (c *Channel) PublishWithOptions(exchange, routingKey string, mandatory, immediate bool, msg rabbitmq.Publishing) error {
+	c.publishMu.Lock()
+	defer c.publishMu.Unlock()
+	if err := c.lock(); err != nil {
+		return err
+	}
+	b := c.broker
+
+	ex, ok := b.exchanges[exchange]
+	if !ok {
+		c.unlock()
+		return fmt.Errorf("%w: exchange %q", ErrNotFound, exchange)
+	}
+	if ex.internal {
+		c.unlock()
+		return fmt.Errorf("%w: exchange %q is internal", ErrAccessRefused, exchange)
+	}
+	if msg.ReplyTo == DirectReplyTo {
+		if c.replyQueue == nil {
+			c.unlock()
+			return preconditionFailed("fast reply consumer does not exist")
+		}
+		msg.ReplyTo = c.replyQueue.name
+	}
+	msg.Headers = copyTable(msg.Headers)
+
+	queues := b.route(ex, routingKey, msg.Headers)
+	accepted := true
+	for _, q := range queues {
+		if !q.enqueue(msg, exchange, routingKey) {
+			accepted = false
+		}
+	}
+	var confirm *rabbitmq.Confirmation
+	if c.confirming {
+		c.published++
+		confirm = &rabbitmq.Confirmation{DeliveryTag: c.published, Ack: accepted}
+	}
+	c.unlock()
+
+	c.notifyMu.Lock()
+	defer c.notifyMu.Unlock()
+	if c.notifyClosed {
+		return nil
+	}
+	if mandatory && len(queues) == 0 {
+		r := returned(msg, exchange, routingKey)
+		for _, l := range c.returns {
+			l <- r
+		}
+	}
+	if confirm != nil {
+		for _, l := range c.confirms {
+			l <- *confirm
+		}
+	}
+	return nil
+}
+
+func returned(msg rabbitmq.Publishing, exchange, routingKey string) rabbitmq.Return {
+	return rabbitmq.Return{
+		ReplyCode:       rabbitmq.ReplyNoRoute,
+		ReplyText:       "NO_ROUTE",
+		Exchange:        exchange,
+		RoutingKey:      routingKey,
+		Headers:         msg.Headers,
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationID:   msg.CorrelationID,
+		ReplyTo:         msg.ReplyTo,
+		Expiration:      msg.Expiration,
+		MessageID:       msg.MessageID,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		UserID:          msg.UserID,
+		AppID:           msg.AppID,
+		Body:            msg.Body,
+	}
+}
+
+// Confirm puts the channel in confirm mode.
+func (c *Channel) Confirm(noWait bool) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	c.confirming = true
+	return nil
+}
+
+// NotifyPublish registers confirm for publish confirmations. It is closed when the channel closes.
+func (c *Channel) NotifyPublish(confirm chan rabbitmq.Confirmation) chan rabbitmq.Confirmation {
+	c.notifyMu.Lock()
+	defer c.notifyMu.Unlock()
+	if c.notifyClosed {
+		close(confirm)
+	} else {
+		c.confirms = append(c.confirms, confirm)
+	}
+	return confirm
+}
+
+// NotifyReturn registers r for returned messages. It is closed when the channel closes.
+func (c *Channel) NotifyReturn(r chan rabbitmq.Return) chan rabbitmq.Return {
+	c.notifyMu.Lock()
+	defer c.notifyMu.Unlock()
+	if c.notifyClosed {
+		close(r)
+	} else {
+		c.returns = append(c.returns, r)
+	}
+	return r
+}
+
+// Qos limits the unacknowledged messages of consumers started afterwards,
+// or of the whole channel when global is set. prefetchSize is ignored.
+func (c *Channel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	c.prefetch = prefetchCount
+	c.global = global
+	return nil
+}
+
+// Consume starts delivering messages of the named queue. Consuming DirectReplyTo
+// requires autoAck and lets publishes on this channel use it as ReplyTo.
+func (c *Channel) Consume(name, consumerTag string, autoAck, exclusive, noLocal, noWait bool, args rabbitmq.Table) (<-chan rabbitmq.Delivery, error) {
+	if err := c.lock(); err != nil {
+		return nil, err
+	}
+	defer c.unlock()
+	b := c.broker
+
+	var q *queue
+	if name == DirectReplyTo {
+		if !autoAck {
+			return nil, preconditionFailed("reply consumer must use autoAck")
+		}
+		if c.replyQueue == nil {
+			c.replyQueue = newQueue(b, fmt.Sprintf("%s.%d", DirectReplyTo, c.id), false, true, true, nil)
+			c.replyQueue.owner = c
+			b.queues[c.replyQueue.name] = c.replyQueue
+		}
+		q = c.replyQueue
+	} else {
+		var err error
+		if q, err = c.queue(name); err != nil {
+			return nil, err
+		}
+	}
+	if q.exclusiveTo != nil || (exclusive && len(q.consumers) > 0) {
+		return nil, fmt.Errorf("%w: queue %q in exclusive use", ErrAccessRefused, q.name)
+	}
+
+	if consumerTag == "" {
+		consumerTag = fmt.Sprintf("ctag-%d", b.next())
+	}
+	if _, ok := c.consumers[consumerTag]; ok {
+		return nil, fmt.Errorf("memory: consumer tag %q already in use", consumerTag)
+	}
+
+	cons := &consumer{
+		tag:     consumerTag,
+		ch:      c,
+		queue:   q,
+		autoAck: autoAck,
+		next:    make(chan inflight, 1),
+		out:     make(chan rabbitmq.Delivery),
+		done:    make(chan struct{}),
+	}
+	if !c.global {
+		cons.prefetch = c.prefetch
+	}
+	if exclusive {
+		q.exclusiveTo = cons
+	}
+	c.consumers[consumerTag] = cons
+	q.consumers = append(q.consumers, cons)
+	go cons.run()
+	q.dispatch()
+	return cons.out, nil
+}
+
+// Get fetches the first ready message of queue, with MessageCount set to the
+// messages left.
+func (c *Channel) Get(queue string, autoAck bool) (rabbitmq.Delivery, bool, error) {
+	if err := c.lock(); err != nil {
+		return rabbitmq.Delivery{}, false, err
+	}
+	defer c.unlock()
+
+	q, err := c.queue(queue)
+	if err != nil {
+		return rabbitmq.Delivery{}, false, err
+	}
+	q.expire()
+	if len(q.messages) == 0 {
+		return rabbitmq.Delivery{}, false, nil
+	}
+	m := q.messages[0]
+	q.messages[0] = nil
+	q.messages = q.messages[1:]
+
+	c.tag++
+	d := m.delivery()
+	d.DeliveryTag = c.tag
+	d.MessageCount = uint32(len(q.messages))
+	d.Acknowledger = c
+	if !autoAck {
+		c.unacked[d.DeliveryTag] = &unacked{queue: q, msg: m}
+	}
+	return d, true, nil
+}
+
+// Cancel stops a consumer and closes its delivery channel. Messages it
+// received but did not settle stay unacknowledged until the channel closes.
+func (c *Channel) Cancel(consumer string, noWait bool) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	if cons, ok := c.consumers[consumer]; ok {
+		cons.cancel()
+	}
+	return nil
+}
+
+func (c *Channel) Ack(tag uint64, multiple bool) error {
+	return c.settle(tag, multiple, func(u *unacked) {})
+}
+
+func (c *Channel) Nack(tag uint64, multiple, requeue bool) error {
+	return c.settle(tag, multiple, func(u *unacked) {
+		if requeue {
+			u.queue.requeue(u.msg)
+		} else {
+			u.queue.deadLetter(u.msg, "rejected")
+		}
+	})
+}
+
+func (c *Channel) Reject(tag uint64, requeue bool) error {
+	return c.Nack(tag, false, requeue)
+}
+
+// settle applies fn to the messages covered by tag, newest first so that
+// requeued messages keep their order, and resumes dispatching to their queues.
+func (c *Channel) settle(tag uint64, multiple bool, fn func(u *unacked)) error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	var tags []uint64
+	if multiple {
+		for t := range c.unacked {
+			if tag == 0 || t <= tag {
+				tags = append(tags, t)
+			}
+		}
+	} else if _, ok := c.unacked[tag]; ok {
+		tags = append(tags, tag)
+	}
+	if len(tags) == 0 && !multiple {
+		return preconditionFailed("unknown delivery tag %d", tag)
+	}
+	slices.Sort(tags)
+	slices.Reverse(tags)
+	c.release(tags, fn)
+	return nil
+}
+
+// release removes the unacked messages with tags, applies fn to each and
+// dispatches their queues. Called with b.mu held.
+func (c *Channel) release(tags []uint64, fn func(u *unacked)) {
+	var queues []*queue
+	for _, t := range tags {
+		u := c.unacked[t]
+		delete(c.unacked, t)
+		if u.consumer != nil {
+			u.consumer.unacked--
+		}
+		fn(u)
+		if !slices.Contains(queues, u.queue) {
+			queues = append(queues, u.queue)
+		}
+	}
+	for _, q := range queues {
+		q.dispatch()
+	}
+}
+
+// Close cancels the channel's consumers, requeues its unacknowledged
+// messages, deletes its exclusive queues and closes its notify channels.
+func (c *Channel) Close() error {
+	b := c.broker
+	b.mu.Lock()
+	if c.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	for _, cons := range c.consumers {
+		cons.cancel()
+	}
+	tags := make([]uint64, 0, len(c.unacked))
+	for t := range c.unacked {
+		tags = append(tags, t)
+	}
+	slices.Sort(tags)
+	slices.Reverse(tags)
+	c.release(tags, func(u *unacked) { u.queue.requeue(u.msg) })
+	for _, q := range b.queues {
+		if q.owner == c {
+			q.remove()
+		}
+	}
+	b.mu.Unlock()
+
+	c.notifyMu.Lock()
+	defer c.notifyMu.Unlock()
+	c.notifyClosed = true
+	for _, l := range c.confirms {
+		close(l)
+	}
+	for _, l := range c.returns {
+		close(l)
+	}
+	return nil
+}
+
+var (
+	_ rabbitmq.Channel      = (*Channel)(nil)
+	_ rabbitmq.Acknowledger = (*Channel)(nil)
+)
@@ -0,0 +1,383 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eugene-ruby/xconnect/rabbitmq"
+	"github.com/eugene-ruby/xconnect/rabbitmq/dlq"
+	"github.com/eugene-ruby/xconnect/rabbitmq/memory"
+	"github.com/eugene-ruby/xconnect/rabbitmq/rpc"
+	"github.com/stretchr/testify/require"
+)
+
+func receive(t *testing.T, deliveries <-chan rabbitmq.Delivery) rabbitmq.Delivery {
+	t.Helper()
+	select {
+	case d, ok := <-deliveries:
+		require.True(t, ok, "delivery channel closed")
+		return d
+	case <-time.After(time.Second):
+		t.Fatal("no delivery")
+		return rabbitmq.Delivery{}
+	}
+}
+
+func bodies(t *testing.T, ch *memory.Channel, queue string) []string {
+	t.Helper()
+	var out []string
+	for {
+		d, ok, err := ch.Get(queue, true)
+		require.NoError(t, err)
+		if !ok {
+			return out
+		}
+		out = append(out, string(d.Body))
+	}
+}
+
+func TestRouting(t *testing.T) {
+	ch := memory.NewBroker().Channel()
+
+	err := rabbitmq.Topology{
+		Exchanges: []rabbitmq.ExchangeSpec{
+			{Name: "events", Kind: rabbitmq.ExchangeTopic},
+			{Name: "audit", Kind: rabbitmq.ExchangeFanout},
+			{Name: "tenants", Kind: rabbitmq.ExchangeHeaders},
+		},
+		Queues: []rabbitmq.QueueSpec{{Name: "created"}, {Name: "orders"}, {Name: "log"}, {Name: "acme"}, {Name: "vip"}},
+		Bindings: []rabbitmq.BindingSpec{
+			{Source: "events", Destination: "created", RoutingKey: "*.created"},
+			{Source: "events", Destination: "orders", RoutingKey: "order.#"},
+			{Source: "events", Destination: "audit", DestinationType: rabbitmq.DestinationExchange, RoutingKey: "#"},
+			{Source: "audit", Destination: "log"},
+			{Source: "tenants", Destination: "acme", Args: rabbitmq.Table{"tenant": "acme"}},
+			{Source: "tenants", Destination: "vip", Args: rabbitmq.Table{"x-match": "any", "tier": "gold", "priority": int32(1)}},
+		},
+	}.Apply(ch)
+	require.NoError(t, err)
+
+	require.NoError(t, ch.Publish("events", "order.created", []byte("1")))
+	require.NoError(t, ch.Publish("events", "order.paid.eu", []byte("2")))
+	require.NoError(t, ch.Publish("events", "user.created", []byte("3")))
+	require.NoError(t, ch.Publish("events", "order", []byte("4")))
+	require.NoError(t, ch.Publish("", "orders", []byte("5")))
+
+	require.Equal(t, []string{"1", "3"}, bodies(t, ch, "created"))
+	require.Equal(t, []string{"1", "2", "4", "5"}, bodies(t, ch, "orders"))
+	require.Equal(t, []string{"1", "2", "3", "4"}, bodies(t, ch, "log"))
+
+	for i, headers := range []rabbitmq.Table{
+		{"tenant": "acme", "tier": "gold"},
+		{"tenant": "other", "priority": int64(1)},
+		{"tenant": "other"},
+	} {
+		require.NoError(t, ch.PublishWithOptions("tenants", "", false, false, rabbitmq.Publishing{
+			Headers: headers,
+			Body:    []byte{byte('a' + i)},
+		}))
+	}
+	require.Equal(t, []string{"a"}, bodies(t, ch, "acme"))
+	require.Equal(t, []string{"a", "b"}, bodies(t, ch, "vip"))
+}
+
+func TestMandatoryReturnAndConfirms(t *testing.T) {
+	ch := memory.NewBroker().Channel()
+	_, err := ch.QueueDeclare("bounded", false, false, false, false, rabbitmq.Table{
+		"x-max-length": 1,
+		"x-overflow":   "reject-publish",
+	})
+	require.NoError(t, err)
+
+	pub, err := rabbitmq.NewConfirmPublisher(ch, rabbitmq.ConfirmConfig{Mandatory: true, Timeout: time.Second})
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	require.NoError(t, pub.Publish(ctx, "", "bounded", []byte("1")))
+	require.Error(t, pub.Publish(ctx, "", "bounded", []byte("2")))
+	require.ErrorIs(t, pub.Publish(ctx, "amq.direct", "nowhere", []byte("3")), rabbitmq.ErrUnroutable)
+	require.ErrorIs(t, ch.Publish("missing", "key", nil), memory.ErrNotFound)
+}
+
+func TestConfirmsArriveInTagOrder(t *testing.T) {
+	ch := memory.NewBroker().Channel()
+	require.NoError(t, ch.Confirm(false))
+	confirms := ch.NotifyPublish(make(chan rabbitmq.Confirmation, 1))
+
+	const publishers, each = 8, 50
+	var wg sync.WaitGroup
+	for i := 0; i < publishers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < each; j++ {
+				_ = ch.Publish("", "nowhere", nil)
+			}
+		}()
+	}
+
+	for tag := uint64(1); tag <= publishers*each; tag++ {
+		select {
+		case c := <-confirms:
+			require.Equal(t, tag, c.DeliveryTag)
+		case <-time.After(time.Second):
+			t.Fatalf("no confirm for tag %d", tag)
+		}
+	}
+	wg.Wait()
+}
+
+func TestCompetingConsumers(t *testing.T) {
+	broker := memory.NewBroker()
+	ch := broker.Channel()
+	_, err := ch.QueueDeclare("jobs", true, false, false, false, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, ch.Qos(1, 0, false))
+	first, err := ch.Consume("jobs", "first", false, false, false, false, nil)
+	require.NoError(t, err)
+	second, err := ch.Consume("jobs", "second", false, false, false, false, nil)
+	require.NoError(t, err)
+
+	for _, body := range []string{"1", "2", "3", "4"} {
+		require.NoError(t, ch.Publish("", "jobs", []byte(body)))
+	}
+
+	a, b := receive(t, first), receive(t, second)
+	require.Equal(t, "1", string(a.Body))
+	require.Equal(t, "2", string(b.Body))
+	require.Equal(t, "first", a.ConsumerTag)
+
+	require.NoError(t, a.Nack(true))
+	require.NoError(t, b.Ack())
+
+	// With a prefetch of one, each consumer holds a single message at a time.
+	got := map[string]bool{}
+	for len(got) < 3 {
+		var d rabbitmq.Delivery
+		select {
+		case d = <-first:
+		case d = <-second:
+		case <-time.After(time.Second):
+			t.Fatalf("only received %v", got)
+		}
+		require.Equal(t, d.Body[0] == '1', d.Redelivered)
+		got[string(d.Body)] = true
+		require.NoError(t, d.Ack())
+	}
+	require.Equal(t, map[string]bool{"1": true, "3": true, "4": true}, got)
+	require.ErrorIs(t, a.Ack(), rabbitmq.ErrPreconditionFailed)
+}
+
+func TestPrefetchAndCloseRequeues(t *testing.T) {
+	broker := memory.NewBroker()
+	ch := broker.Channel()
+	_, err := ch.QueueDeclare("jobs", true, false, false, false, nil)
+	require.NoError(t, err)
+	for _, body := range []string{"1", "2", "3"} {
+		require.NoError(t, ch.Publish("", "jobs", []byte(body)))
+	}
+
+	consumerCh := broker.Channel()
+	require.NoError(t, consumerCh.Qos(2, 0, false))
+	deliveries, err := consumerCh.Consume("jobs", "", false, false, false, false, nil)
+	require.NoError(t, err)
+	receive(t, deliveries)
+	receive(t, deliveries)
+
+	select {
+	case d := <-deliveries:
+		t.Fatalf("delivery %q past the prefetch limit", d.Body)
+	case <-time.After(20 * time.Millisecond):
+	}
+	q, err := ch.QueueInspect("jobs")
+	require.NoError(t, err)
+	require.Equal(t, rabbitmq.Queue{Name: "jobs", Messages: 1, Consumers: 1}, q)
+
+	require.NoError(t, consumerCh.Close())
+	_, open := <-deliveries
+	require.False(t, open)
+	require.ErrorIs(t, consumerCh.Publish("", "jobs", nil), rabbitmq.ErrClosed)
+
+	d, ok, err := ch.Get("jobs", true)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "1", string(d.Body))
+	require.True(t, d.Redelivered)
+	require.Equal(t, uint32(2), d.MessageCount)
+}
+
+func TestTTLAndDeadLettering(t *testing.T) {
+	ch := memory.NewBroker().Channel()
+	err := rabbitmq.Topology{
+		Exchanges: []rabbitmq.ExchangeSpec{{Name: "orders", Kind: rabbitmq.ExchangeDirect}, {Name: "dlx", Kind: rabbitmq.ExchangeFanout}},
+		Queues: []rabbitmq.QueueSpec{
+			{Name: "orders", MessageTTL: 20 * time.Millisecond, DeadLetterExchange: "dlx"},
+			{Name: "orders.dlq"},
+		},
+		Bindings: []rabbitmq.BindingSpec{
+			{Source: "orders", Destination: "orders", RoutingKey: "order.created"},
+			{Source: "dlx", Destination: "orders.dlq"},
+		},
+	}.Apply(ch)
+	require.NoError(t, err)
+
+	require.NoError(t, ch.Publish("orders", "order.created", []byte("rejected")))
+	require.NoError(t, ch.Publish("orders", "order.created", []byte("expired")))
+
+	first, ok, err := ch.Get("orders", false)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NoError(t, first.Reject(false))
+
+	parked, err := ch.Consume("orders.dlq", "", true, false, false, false, nil)
+	require.NoError(t, err)
+	rejected := receive(t, parked)
+	require.Equal(t, "rejected", string(rejected.Body))
+	require.Equal(t, "dlx", rejected.Exchange)
+	deaths := dlq.Deaths(rejected)
+	require.Len(t, deaths, 1)
+	require.Equal(t, "rejected", deaths[0].Reason)
+	require.Equal(t, "orders", deaths[0].Queue)
+	require.Equal(t, []string{"order.created"}, deaths[0].RoutingKeys)
+
+	expired := receive(t, parked)
+	require.Equal(t, "expired", string(expired.Body))
+	msgs := []dlq.Message{{Delivery: expired, Deaths: dlq.Deaths(expired)}}
+	require.Equal(t, "expired", msgs[0].Deaths[0].Reason)
+
+	exchange, key, err := msgs[0].Origin()
+	require.NoError(t, err)
+	require.Equal(t, "orders", exchange)
+	require.Equal(t, "order.created", key)
+}
+
+func TestMaxLengthDropsHead(t *testing.T) {
+	ch := memory.NewBroker().Channel()
+	_, err := ch.QueueDeclare("latest", false, false, false, false, rabbitmq.Table{"x-max-length": int64(2)})
+	require.NoError(t, err)
+	for _, body := range []string{"1", "2", "3"} {
+		require.NoError(t, ch.Publish("", "latest", []byte(body)))
+	}
+	require.Equal(t, []string{"2", "3"}, bodies(t, ch, "latest"))
+}
+
+func TestDeclarationConflicts(t *testing.T) {
+	broker := memory.NewBroker()
+	ch := broker.Channel()
+
+	_, err := ch.QueueDeclare("orders", true, false, false, false, rabbitmq.Table{"x-queue-type": "quorum"})
+	require.NoError(t, err)
+	_, err = ch.QueueDeclare("orders", true, false, false, false, rabbitmq.Table{"x-queue-type": "quorum"})
+	require.NoError(t, err)
+
+	err = rabbitmq.Topology{Queues: []rabbitmq.QueueSpec{{Name: "orders", Durable: true}}}.Apply(ch)
+	var declareErr *rabbitmq.DeclareError
+	require.ErrorAs(t, err, &declareErr)
+	require.Equal(t, "orders", declareErr.Name)
+	require.ErrorIs(t, err, rabbitmq.ErrPreconditionFailed)
+
+	require.ErrorIs(t, ch.ExchangeDeclare("amq.custom", "direct", true, false, false, false, nil), memory.ErrAccessRefused)
+	require.ErrorIs(t, ch.QueueBind("orders", "orders", "", false, nil), memory.ErrAccessRefused)
+	_, err = ch.QueueInspect("missing")
+	require.ErrorIs(t, err, memory.ErrNotFound)
+
+	other := broker.Channel()
+	q, err := other.QueueDeclare("", false, true, true, false, nil)
+	require.NoError(t, err)
+	_, err = ch.Consume(q.Name, "", true, false, false, false, nil)
+	require.ErrorIs(t, err, memory.ErrAccessRefused)
+	require.NoError(t, other.Close())
+	_, err = ch.QueueInspect(q.Name)
+	require.ErrorIs(t, err, memory.ErrNotFound)
+
+	n, err := ch.QueueDelete("orders", false, false, false)
+	require.NoError(t, err)
+	require.Zero(t, n)
+}
+
+func TestWorkerRetriesThroughTTLQueues(t *testing.T) {
+	broker := memory.NewBroker()
+	ch := broker.Channel()
+
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	done := make(chan string, 2)
+	worker := rabbitmq.NewWorker(ch, rabbitmq.WorkerConfig{
+		Queue:   "orders",
+		Declare: true, BindExchange: "amq.direct", BindRoutingKey: "orders",
+		Retry: &rabbitmq.RetryConfig{Delays: []time.Duration{10 * time.Millisecond}, MaxAttempts: 2},
+		Handler: func(d rabbitmq.Delivery) error {
+			mu.Lock()
+			attempts[string(d.Body)]++
+			n := attempts[string(d.Body)]
+			mu.Unlock()
+			if string(d.Body) == "flaky" && n == 1 || string(d.Body) == "broken" {
+				return errors.New("boom")
+			}
+			done <- string(d.Body)
+			return nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, worker.Start(ctx))
+	require.NoError(t, ch.Publish("amq.direct", "orders", []byte("flaky")))
+	require.NoError(t, ch.Publish("amq.direct", "orders", []byte("broken")))
+
+	select {
+	case body := <-done:
+		require.Equal(t, "flaky", body)
+	case <-time.After(time.Second):
+		t.Fatal("message was not retried")
+	}
+	require.Eventually(t, func() bool {
+		q, err := ch.QueueInspect("orders.dlq")
+		return err == nil && q.Messages == 1
+	}, time.Second, 5*time.Millisecond)
+
+	cancel()
+	worker.Wait()
+
+	parked, ok, err := ch.Get("orders.dlq", true)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "broken", string(parked.Body))
+	require.Equal(t, "boom", parked.Headers[rabbitmq.RetryErrorHeader])
+	require.Equal(t, map[string]int{"flaky": 2, "broken": 2}, attempts)
+}
+
+func TestRPCOverDirectReplyTo(t *testing.T) {
+	broker := memory.NewBroker()
+
+	serverCh := broker.Channel()
+	server := rpc.NewServer(serverCh, rabbitmq.WorkerConfig{Queue: "echo", Declare: true, BindExchange: "amq.direct", BindRoutingKey: "echo", OnError: func(error) {}},
+		func(ctx context.Context, req rabbitmq.Delivery) (rabbitmq.Publishing, error) {
+			if len(req.Body) == 0 {
+				return rabbitmq.Publishing{}, errors.New("empty request")
+			}
+			return rabbitmq.Publishing{Body: append([]byte("echo: "), req.Body...)}, nil
+		})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, server.Start(ctx))
+
+	client, err := rpc.NewClient(broker.Channel(), rpc.ClientConfig{Timeout: time.Second})
+	require.NoError(t, err)
+	defer client.Close()
+
+	reply, err := client.Call(ctx, "amq.direct", "echo", []byte("hi"))
+	require.NoError(t, err)
+	require.Equal(t, "echo: hi", string(reply.Body))
+
+	_, err = client.Call(ctx, "amq.direct", "echo", nil)
+	var remote *rpc.RemoteError
+	require.ErrorAs(t, err, &remote)
+	require.Equal(t, "empty request", remote.Message)
+
+	_, err = client.Call(ctx, "amq.direct", "nobody", []byte("hi"))
+	require.ErrorIs(t, err, rabbitmq.ErrUnroutable)
+}
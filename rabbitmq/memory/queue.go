@@ -0,0 +1,281 @@
+package memory
+
+import (
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/eugene-ruby/xconnect/rabbitmq"
+)
+
+// Overflow behaviours selected with the x-overflow queue argument.
+const (
+	overflowDropHead      = "drop-head"
+	overflowRejectPublish = "reject-publish"
+)
+
+// queue is a declared queue holding ready messages in FIFO order.
+type queue struct {
+	broker *Broker
+
+	name       string
+	durable    bool
+	autoDelete bool
+	exclusive  bool
+	args       rabbitmq.Table
+	owner      *Channel // declaring channel of an exclusive queue
+
+	ttl         time.Duration // x-message-ttl, negative when unset
+	maxLength   int64         // x-max-length, negative when unset
+	overflow    string        // x-overflow
+	dlx         string        // x-dead-letter-exchange
+	hasDLX      bool
+	dlrk        string // x-dead-letter-routing-key
+	hasDLRK     bool
+	exclusiveTo *consumer // consumer holding exclusive access
+
+	messages  []*message
+	consumers []*consumer
+	next      int // round-robin position among consumers
+	deleted   bool
+}
+
+func newQueue(b *Broker, name string, durable, autoDelete, exclusive bool, args rabbitmq.Table) *queue {
+	q := &queue{
+		broker:     b,
+		name:       name,
+		durable:    durable,
+		autoDelete: autoDelete,
+		exclusive:  exclusive,
+		args:       copyTable(args),
+		ttl:        -1,
+		maxLength:  -1,
+		overflow:   overflowDropHead,
+	}
+	if ms, ok := toInt64(args["x-message-ttl"]); ok {
+		q.ttl = time.Duration(ms) * time.Millisecond
+	}
+	if n, ok := toInt64(args["x-max-length"]); ok {
+		q.maxLength = n
+	}
+	if s, ok := args["x-overflow"].(string); ok {
+		q.overflow = s
+	}
+	q.dlx, q.hasDLX = args["x-dead-letter-exchange"].(string)
+	q.dlrk, q.hasDLRK = args["x-dead-letter-routing-key"].(string)
+	return q
+}
+
+func (q *queue) info() rabbitmq.Queue {
+	return rabbitmq.Queue{Name: q.name, Messages: len(q.messages), Consumers: len(q.consumers)}
+}
+
+// message is a copy of a published message held by one queue.
+type message struct {
+	pub         rabbitmq.Publishing
+	exchange    string
+	routingKey  string
+	redelivered bool
+	expires     time.Time // zero when the message does not expire
+}
+
+// delivery converts m into a Delivery with its own copy of the headers.
+func (m *message) delivery() rabbitmq.Delivery {
+	p := m.pub
+	return rabbitmq.Delivery{
+		Headers:         copyTable(p.Headers),
+		ContentType:     p.ContentType,
+		ContentEncoding: p.ContentEncoding,
+		DeliveryMode:    p.DeliveryMode,
+		Priority:        p.Priority,
+		CorrelationID:   p.CorrelationID,
+		ReplyTo:         p.ReplyTo,
+		Expiration:      p.Expiration,
+		MessageID:       p.MessageID,
+		Timestamp:       p.Timestamp,
+		Type:            p.Type,
+		UserID:          p.UserID,
+		AppID:           p.AppID,
+		Redelivered:     m.redelivered,
+		Exchange:        m.exchange,
+		RoutingKey:      m.routingKey,
+		Body:            p.Body,
+	}
+}
+
+// enqueue appends a message unless the queue is full and rejects publishes,
+// then delivers to ready consumers. Called with b.mu held.
+func (q *queue) enqueue(pub rabbitmq.Publishing, exchange, routingKey string) bool {
+	m := &message{pub: pub, exchange: exchange, routingKey: routingKey}
+
+	ttl := q.ttl
+	if ms, err := strconv.ParseInt(pub.Expiration, 10, 64); err == nil && ms >= 0 {
+		if d := time.Duration(ms) * time.Millisecond; ttl < 0 || d < ttl {
+			ttl = d
+		}
+	}
+	if ttl >= 0 {
+		m.expires = time.Now().Add(ttl)
+		time.AfterFunc(ttl, func() {
+			q.broker.mu.Lock()
+			defer q.broker.mu.Unlock()
+			q.dispatch()
+		})
+	}
+
+	if q.maxLength >= 0 && int64(len(q.messages)) >= q.maxLength {
+		if q.overflow == overflowRejectPublish {
+			return false
+		}
+		if q.maxLength == 0 {
+			q.deadLetter(m, "maxlen")
+			return true
+		}
+		for int64(len(q.messages)) >= q.maxLength {
+			head := q.messages[0]
+			q.messages = q.messages[1:]
+			q.deadLetter(head, "maxlen")
+		}
+	}
+
+	q.messages = append(q.messages, m)
+	q.dispatch()
+	return true
+}
+
+// requeue puts messages back at the head of the queue, keeping their order,
+// and marks them redelivered. Called with b.mu held.
+func (q *queue) requeue(msgs ...*message) {
+	if q.deleted || len(msgs) == 0 {
+		return
+	}
+	for _, m := range msgs {
+		m.redelivered = true
+	}
+	q.messages = append(slices.Clone(msgs), q.messages...)
+	q.dispatch()
+}
+
+// expire dead-letters the messages whose TTL has passed. Called with b.mu held.
+func (q *queue) expire() {
+	now := time.Now()
+	kept := q.messages[:0]
+	var expired []*message
+	for _, m := range q.messages {
+		if !m.expires.IsZero() && !now.Before(m.expires) {
+			expired = append(expired, m)
+		} else {
+			kept = append(kept, m)
+		}
+	}
+	clear(q.messages[len(kept):])
+	q.messages = kept
+	for _, m := range expired {
+		q.deadLetter(m, "expired")
+	}
+}
+
+// dispatch expires stale messages and hands the rest to ready consumers in
+// round-robin order. Called with b.mu held.
+func (q *queue) dispatch() {
+	if q.deleted {
+		return
+	}
+	q.expire()
+	for len(q.messages) > 0 {
+		c := q.readyConsumer()
+		if c == nil {
+			return
+		}
+		m := q.messages[0]
+		q.messages[0] = nil
+		q.messages = q.messages[1:]
+		c.deliver(m)
+	}
+}
+
+func (q *queue) readyConsumer() *consumer {
+	n := len(q.consumers)
+	for i := 0; i < n; i++ {
+		c := q.consumers[(q.next+i)%n]
+		if c.ready() {
+			q.next = (q.next + i + 1) % n
+			return c
+		}
+	}
+	return nil
+}
+
+// deadLetter republishes m to the queue's dead-letter exchange, recording
+// the death in the x-death header. Messages are dropped when the queue has
+// no dead-letter exchange. Called with b.mu held.
+func (q *queue) deadLetter(m *message, reason string) {
+	if !q.hasDLX {
+		return
+	}
+	ex, ok := q.broker.exchanges[q.dlx]
+	if !ok {
+		return
+	}
+	key := m.routingKey
+	if q.hasDLRK {
+		key = q.dlrk
+	}
+
+	pub := m.pub
+	pub.Headers = copyTable(pub.Headers)
+	if pub.Headers == nil {
+		pub.Headers = rabbitmq.Table{}
+	}
+	pub.Headers["x-death"] = q.deaths(pub.Headers, m, reason)
+	if _, ok := pub.Headers["x-first-death-queue"]; !ok {
+		pub.Headers["x-first-death-queue"] = q.name
+		pub.Headers["x-first-death-reason"] = reason
+		pub.Headers["x-first-death-exchange"] = m.exchange
+	}
+	// The per-message TTL is dropped so the message does not expire again.
+	pub.Expiration = ""
+
+	for _, target := range q.broker.route(ex, key, pub.Headers) {
+		target.enqueue(pub, q.dlx, key)
+	}
+}
+
+// deaths returns the x-death history of m with this death first, counting
+// repeated deaths in the same queue for the same reason.
+func (q *queue) deaths(headers rabbitmq.Table, m *message, reason string) []interface{} {
+	previous, _ := headers["x-death"].([]interface{})
+	count := int64(1)
+	deaths := make([]interface{}, 1, len(previous)+1)
+	for _, entry := range previous {
+		table, ok := entry.(rabbitmq.Table)
+		if ok && table["queue"] == q.name && table["reason"] == reason {
+			n, _ := toInt64(table["count"])
+			count = n + 1
+			continue
+		}
+		deaths = append(deaths, entry)
+	}
+	deaths[0] = rabbitmq.Table{
+		"queue":        q.name,
+		"reason":       reason,
+		"count":        count,
+		"exchange":     m.exchange,
+		"routing-keys": []interface{}{m.routingKey},
+		"time":         time.Now().Truncate(time.Second),
+	}
+	return deaths
+}
+
+// remove deletes the queue, its bindings and its consumers. Called with b.mu held.
+func (q *queue) remove() int {
+	n := len(q.messages)
+	q.deleted = true
+	q.messages = nil
+	delete(q.broker.queues, q.name)
+	q.broker.unbindAll(q.name, false)
+	for _, c := range slices.Clone(q.consumers) {
+		c.cancel()
+	}
+	return n
+}
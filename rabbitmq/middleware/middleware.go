@@ -0,0 +1,112 @@
+// Package middleware provides reusable rabbitmq.Middleware for Worker handlers
+// and rabbitmq.PublishInterceptor for Publishers.
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/eugene-ruby/xconnect/rabbitmq"
+)
+
+// PanicError is returned by Recover when the handler panicked.
+type PanicError struct {
+	Value interface{} // value passed to panic
+	Stack []byte      // stack of the panicking goroutine
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("middleware: handler panicked: %v", e.Value)
+}
+
+// Recover turns a handler panic into a *PanicError so the worker keeps
+// running. The message is settled like any other failed message.
+func Recover() rabbitmq.Middleware {
+	return func(next rabbitmq.ContextHandlerFunc) rabbitmq.ContextHandlerFunc {
+		return func(ctx context.Context, d rabbitmq.Delivery) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = &PanicError{Value: r, Stack: debug.Stack()}
+				}
+			}()
+			return next(ctx, d)
+		}
+	}
+}
+
+// Logging logs every handled message to logger: failures at error level,
+// successes at debug level.
+func Logging(logger *slog.Logger) rabbitmq.Middleware {
+	return func(next rabbitmq.ContextHandlerFunc) rabbitmq.ContextHandlerFunc {
+		return func(ctx context.Context, d rabbitmq.Delivery) error {
+			start := time.Now()
+			err := next(ctx, d)
+
+			attrs := []slog.Attr{
+				slog.String("exchange", d.Exchange),
+				slog.String("routing_key", d.RoutingKey),
+				slog.String("consumer_tag", d.ConsumerTag),
+				slog.Uint64("delivery_tag", d.DeliveryTag),
+				slog.String("message_id", d.MessageID),
+				slog.Bool("redelivered", d.Redelivered),
+				slog.Duration("duration", time.Since(start)),
+			}
+			if err != nil {
+				attrs = append(attrs, slog.Any("error", err))
+				logger.LogAttrs(ctx, slog.LevelError, "message handler failed", attrs...)
+			} else {
+				logger.LogAttrs(ctx, slog.LevelDebug, "message handled", attrs...)
+			}
+			return err
+		}
+	}
+}
+
+// Duration calls observe with the time every handler call took and its result.
+func Duration(observe func(d rabbitmq.Delivery, elapsed time.Duration, err error)) rabbitmq.Middleware {
+	return func(next rabbitmq.ContextHandlerFunc) rabbitmq.ContextHandlerFunc {
+		return func(ctx context.Context, d rabbitmq.Delivery) error {
+			start := time.Now()
+			err := next(ctx, d)
+			observe(d, time.Since(start), err)
+			return err
+		}
+	}
+}
+
+// Timeout cancels the handler context after timeout. Handlers must watch
+// ctx.Done for the timeout to take effect.
+func Timeout(timeout time.Duration) rabbitmq.Middleware {
+	return func(next rabbitmq.ContextHandlerFunc) rabbitmq.ContextHandlerFunc {
+		return func(ctx context.Context, d rabbitmq.Delivery) error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return next(ctx, d)
+		}
+	}
+}
+
+// Limit allows at most n concurrent handler calls across every handler it
+// wraps, so one Limit can be shared by several workers. A call that gives up
+// waiting because its context is done returns an error that requeues the message.
+// Limit panics if n is less than one.
+func Limit(n int) rabbitmq.Middleware {
+	if n < 1 {
+		panic(fmt.Sprintf("middleware: Limit needs at least one handler slot, got %d", n))
+	}
+	slots := make(chan struct{}, n)
+	return func(next rabbitmq.ContextHandlerFunc) rabbitmq.ContextHandlerFunc {
+		return func(ctx context.Context, d rabbitmq.Delivery) error {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return rabbitmq.Requeue(fmt.Errorf("middleware: waiting for handler slot: %w", ctx.Err()))
+			}
+			defer func() { <-slots }()
+			return next(ctx, d)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package middleware_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eugene-ruby/xconnect/rabbitmq"
+	"github.com/eugene-ruby/xconnect/rabbitmq/middleware"
+	"github.com/eugene-ruby/xconnect/rabbitmq/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecover(t *testing.T) {
+	handler := middleware.Recover()(func(ctx context.Context, d rabbitmq.Delivery) error {
+		panic("boom")
+	})
+
+	err := handler(context.Background(), rabbitmq.Delivery{})
+
+	var panicErr *middleware.PanicError
+	require.ErrorAs(t, err, &panicErr)
+	require.Equal(t, "boom", panicErr.Value)
+	require.NotEmpty(t, panicErr.Stack)
+}
+
+func TestRecover_KeepsWorkerRunning(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	mock.ConsumeMessages <- rabbitmq.Delivery{Body: []byte("panic")}
+	mock.ConsumeMessages <- rabbitmq.Delivery{Body: []byte("ok")}
+	close(mock.ConsumeMessages)
+
+	worker := rabbitmq.NewWorker(mock, rabbitmq.WorkerConfig{
+		Queue:       "test_queue",
+		ConsumerTag: "test_consumer",
+		Middleware:  []rabbitmq.Middleware{middleware.Recover()},
+		Handler: func(d rabbitmq.Delivery) error {
+			if string(d.Body) == "panic" {
+				panic("bad message")
+			}
+			return nil
+		},
+		OnError: func(error) {},
+	})
+	require.NoError(t, worker.Start(context.Background()))
+	worker.Wait()
+
+	require.Equal(t, []mocks.Settlement{{DeliveryTag: 1}}, mock.Nacked())
+	require.Equal(t, []mocks.Settlement{{DeliveryTag: 2}}, mock.Acked())
+}
+
+func TestLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	handler := middleware.Logging(logger)(func(ctx context.Context, d rabbitmq.Delivery) error {
+		if d.MessageID == "bad" {
+			return errors.New("invalid payload")
+		}
+		return nil
+	})
+
+	require.NoError(t, handler(context.Background(), rabbitmq.Delivery{MessageID: "good", RoutingKey: "orders.created"}))
+	require.Error(t, handler(context.Background(), rabbitmq.Delivery{MessageID: "bad"}))
+
+	out := buf.String()
+	require.Contains(t, out, `level=DEBUG msg="message handled"`)
+	require.Contains(t, out, "routing_key=orders.created")
+	require.Contains(t, out, `level=ERROR msg="message handler failed"`)
+	require.Contains(t, out, `error="invalid payload"`)
+}
+
+func TestDuration(t *testing.T) {
+	var elapsed time.Duration
+	var observedErr error
+	handlerErr := errors.New("failed")
+
+	handler := middleware.Duration(func(d rabbitmq.Delivery, e time.Duration, err error) {
+		elapsed, observedErr = e, err
+	})(func(ctx context.Context, d rabbitmq.Delivery) error {
+		time.Sleep(5 * time.Millisecond)
+		return handlerErr
+	})
+
+	require.ErrorIs(t, handler(context.Background(), rabbitmq.Delivery{}), handlerErr)
+	require.GreaterOrEqual(t, elapsed, 5*time.Millisecond)
+	require.ErrorIs(t, observedErr, handlerErr)
+}
+
+func TestTimeout(t *testing.T) {
+	handler := middleware.Timeout(10 * time.Millisecond)(func(ctx context.Context, d rabbitmq.Delivery) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	require.ErrorIs(t, handler(context.Background(), rabbitmq.Delivery{}), context.DeadlineExceeded)
+}
+
+func TestLimit(t *testing.T) {
+	var running, peak atomic.Int32
+	handler := rabbitmq.Chain(func(ctx context.Context, d rabbitmq.Delivery) error {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		running.Add(-1)
+		return nil
+	}, middleware.Limit(2))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = handler(context.Background(), rabbitmq.Delivery{})
+		}()
+	}
+	wg.Wait()
+
+	require.LessOrEqual(t, peak.Load(), int32(2))
+}
+
+func TestLimit_PanicsWithoutSlots(t *testing.T) {
+	require.PanicsWithValue(t, "middleware: Limit needs at least one handler slot, got 0", func() { middleware.Limit(0) })
+	require.Panics(t, func() { middleware.Limit(-1) })
+}
+
+func TestLimit_RequeuesWhenContextDone(t *testing.T) {
+	limit := middleware.Limit(1)
+	release := make(chan struct{})
+	busy := limit(func(ctx context.Context, d rabbitmq.Delivery) error {
+		<-release
+		return nil
+	})
+	go func() { _ = busy(context.Background(), rabbitmq.Delivery{}) }()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	waiting := limit(func(ctx context.Context, d rabbitmq.Delivery) error { return nil })
+
+	require.Eventually(t, func() bool {
+		return rabbitmq.IsRequeue(waiting(ctx, rabbitmq.Delivery{}))
+	}, time.Second, time.Millisecond)
+}
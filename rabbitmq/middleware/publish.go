@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eugene-ruby/xconnect/rabbitmq"
+)
+
+// Headers sets the headers returned by fn on every publish, for example to
+// propagate trace context from ctx. Existing headers with the same key are replaced.
+func Headers(fn func(ctx context.Context) rabbitmq.Table) rabbitmq.PublishInterceptor {
+	return func(next rabbitmq.PublishFunc) rabbitmq.PublishFunc {
+		return func(ctx context.Context, req *rabbitmq.PublishRequest) error {
+			extra := fn(ctx)
+			if len(extra) == 0 {
+				return next(ctx, req)
+			}
+			headers := make(rabbitmq.Table, len(req.Publishing.Headers)+len(extra))
+			for k, v := range req.Publishing.Headers {
+				headers[k] = v
+			}
+			for k, v := range extra {
+				headers[k] = v
+			}
+			req.Publishing.Headers = headers
+			return next(ctx, req)
+		}
+	}
+}
+
+// MessageID sets Publishing.MessageID when it is empty, using generate or a
+// random 128-bit hex string when generate is nil.
+func MessageID(generate func() string) rabbitmq.PublishInterceptor {
+	if generate == nil {
+		generate = randomID
+	}
+	return func(next rabbitmq.PublishFunc) rabbitmq.PublishFunc {
+		return func(ctx context.Context, req *rabbitmq.PublishRequest) error {
+			if req.Publishing.MessageID == "" {
+				req.Publishing.MessageID = generate()
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+// Timestamp sets Publishing.Timestamp to the current time when it is zero.
+func Timestamp() rabbitmq.PublishInterceptor {
+	return func(next rabbitmq.PublishFunc) rabbitmq.PublishFunc {
+		return func(ctx context.Context, req *rabbitmq.PublishRequest) error {
+			if req.Publishing.Timestamp.IsZero() {
+				req.Publishing.Timestamp = time.Now()
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+// Validate rejects publishes for which validate returns an error; they never
+// reach the broker.
+func Validate(validate func(req *rabbitmq.PublishRequest) error) rabbitmq.PublishInterceptor {
+	return func(next rabbitmq.PublishFunc) rabbitmq.PublishFunc {
+		return func(ctx context.Context, req *rabbitmq.PublishRequest) error {
+			if err := validate(req); err != nil {
+				return fmt.Errorf("middleware: invalid message for exchange %q with key %q: %w", req.Exchange, req.RoutingKey, err)
+			}
+			return next(ctx, req)
+		}
+	}
+}
+
+// PublishDuration calls observe with the time every publish took and its result.
+func PublishDuration(observe func(req *rabbitmq.PublishRequest, elapsed time.Duration, err error)) rabbitmq.PublishInterceptor {
+	return func(next rabbitmq.PublishFunc) rabbitmq.PublishFunc {
+		return func(ctx context.Context, req *rabbitmq.PublishRequest) error {
+			start := time.Now()
+			err := next(ctx, req)
+			observe(req, time.Since(start), err)
+			return err
+		}
+	}
+}
+
+// Retry retries failed publishes up to attempts times in total, waiting
+// backoff between attempts. It stops early when ctx is done or the channel
+// was closed.
+func Retry(attempts int, backoff rabbitmq.Backoff) rabbitmq.PublishInterceptor {
+	return func(next rabbitmq.PublishFunc) rabbitmq.PublishFunc {
+		return func(ctx context.Context, req *rabbitmq.PublishRequest) error {
+			var err error
+			for attempt := 1; ; attempt++ {
+				if err = next(ctx, req); err == nil || attempt >= attempts || errors.Is(err, rabbitmq.ErrClosed) {
+					return err
+				}
+
+				timer := time.NewTimer(backoff.Duration(attempt))
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+					return errors.Join(err, ctx.Err())
+				}
+			}
+		}
+	}
+}
+
+func randomID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,106 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/eugene-ruby/xconnect/rabbitmq"
+	"github.com/eugene-ruby/xconnect/rabbitmq/middleware"
+	"github.com/eugene-ruby/xconnect/rabbitmq/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+type traceIDKey struct{}
+
+func TestPublishInterceptors_EnrichMessage(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	pub := rabbitmq.NewPublisher(mock, rabbitmq.WithInterceptors(
+		middleware.Headers(func(ctx context.Context) rabbitmq.Table {
+			return rabbitmq.Table{"trace-id": ctx.Value(traceIDKey{})}
+		}),
+		middleware.MessageID(func() string { return "id-1" }),
+		middleware.Timestamp(),
+	))
+
+	headers := rabbitmq.Table{"tenant": "acme"}
+	ctx := context.WithValue(context.Background(), traceIDKey{}, "trace-1")
+	err := pub.PublishWithContext(ctx, "orders", "order.created", false, false, rabbitmq.Publishing{
+		Headers: headers,
+		Body:    []byte("{}"),
+	})
+	require.NoError(t, err)
+
+	msg := mock.PublishedMessages[0].Publishing
+	require.Equal(t, rabbitmq.Table{"tenant": "acme", "trace-id": "trace-1"}, msg.Headers)
+	require.Equal(t, rabbitmq.Table{"tenant": "acme"}, headers)
+	require.Equal(t, "id-1", msg.MessageID)
+	require.WithinDuration(t, time.Now(), msg.Timestamp, time.Minute)
+}
+
+func TestMessageID_KeepsExistingAndGeneratesRandom(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	pub := rabbitmq.NewPublisher(mock, rabbitmq.WithInterceptors(middleware.MessageID(nil)))
+
+	require.NoError(t, pub.PublishWithOptions("", "queue", false, false, rabbitmq.Publishing{MessageID: "fixed"}))
+	require.NoError(t, pub.Publish("", "queue", []byte("x")))
+
+	require.Equal(t, "fixed", mock.PublishedMessages[0].Publishing.MessageID)
+	require.Len(t, mock.PublishedMessages[1].Publishing.MessageID, 32)
+}
+
+func TestValidate(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	pub := rabbitmq.NewPublisher(mock, rabbitmq.WithInterceptors(
+		middleware.Validate(func(req *rabbitmq.PublishRequest) error {
+			if len(req.Publishing.Body) == 0 {
+				return errors.New("empty body")
+			}
+			return nil
+		}),
+	))
+
+	require.ErrorContains(t, pub.Publish("orders", "order.created", nil), "empty body")
+	require.Empty(t, mock.PublishedMessages)
+}
+
+func TestPublishDuration(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	var observed *rabbitmq.PublishRequest
+	pub := rabbitmq.NewPublisher(mock, rabbitmq.WithInterceptors(
+		middleware.PublishDuration(func(req *rabbitmq.PublishRequest, elapsed time.Duration, err error) {
+			observed = req
+		}),
+	))
+
+	require.NoError(t, pub.Publish("orders", "order.created", []byte("x")))
+	require.Equal(t, "order.created", observed.RoutingKey)
+}
+
+func TestRetry(t *testing.T) {
+	attempts := 0
+	send := middleware.Retry(3, rabbitmq.Backoff{Min: time.Millisecond, Max: time.Millisecond})(
+		func(ctx context.Context, req *rabbitmq.PublishRequest) error {
+			attempts++
+			if attempts < 3 {
+				return rabbitmq.ErrNotConnected
+			}
+			return nil
+		})
+
+	require.NoError(t, send(context.Background(), &rabbitmq.PublishRequest{}))
+	require.Equal(t, 3, attempts)
+}
+
+func TestRetry_GivesUp(t *testing.T) {
+	attempts := 0
+	send := middleware.Retry(5, rabbitmq.Backoff{Min: time.Millisecond, Max: time.Millisecond})(
+		func(ctx context.Context, req *rabbitmq.PublishRequest) error {
+			attempts++
+			return rabbitmq.ErrClosed
+		})
+
+	require.ErrorIs(t, send(context.Background(), &rabbitmq.PublishRequest{}), rabbitmq.ErrClosed)
+	require.Equal(t, 1, attempts)
+}
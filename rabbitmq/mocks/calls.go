@@ -0,0 +1,185 @@
+package mocks
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// Call is a recorded MockChannel call.
+type Call struct {
+	Method string        // Channel method name, e.g. "QueueDeclare"
+	N      int           // 1-based number of calls to Method so far, this one included
+	Target string        // queue, exchange or consumer tag the call is about, if any
+	Args   []interface{} // arguments in signature order
+}
+
+// record stores a call and runs the scripts registered for its method,
+// returning the first error one of them produces.
+func (m *MockChannel) record(method, target string, args ...interface{}) error {
+	m.mu.Lock()
+	if m.counts == nil {
+		m.counts = make(map[string]int)
+	}
+	m.counts[method]++
+	call := Call{Method: method, N: m.counts[method], Target: target, Args: args}
+	m.calls = append(m.calls, call)
+	hooks := append([]func(Call) error(nil), m.hooks[method]...)
+	m.broadcast()
+	m.mu.Unlock()
+
+	for _, hook := range hooks {
+		if err := hook(call); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// broadcast wakes up the Wait helpers. Called with m.mu held.
+func (m *MockChannel) broadcast() {
+	if m.changed != nil {
+		close(m.changed)
+		m.changed = nil
+	}
+}
+
+// OnCall registers fn to run on every call to method. A non-nil error fails
+// the call with that error; a failed publish is recorded as a call but not in
+// PublishedMessages.
+func (m *MockChannel) OnCall(method string, fn func(call Call) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.hooks == nil {
+		m.hooks = make(map[string][]func(Call) error)
+	}
+	m.hooks[method] = append(m.hooks[method], fn)
+}
+
+// FailNth makes the nth call to method fail with err, e.g. the third
+// "PublishWithOptions". Calls are counted per method name, so Publish,
+// PublishWithOptions and PublishWithContext each have their own count; use
+// FailNthPublish to count them together.
+func (m *MockChannel) FailNth(method string, n int, err error) {
+	m.OnCall(method, func(call Call) error {
+		if call.N == n {
+			return err
+		}
+		return nil
+	})
+}
+
+// publishMethods are the Channel methods that publish a message.
+var publishMethods = []string{"Publish", "PublishWithOptions", "PublishWithContext"}
+
+// FailNthPublish makes the nth publish fail with err, whichever of Publish,
+// PublishWithOptions or PublishWithContext makes it.
+func (m *MockChannel) FailNthPublish(n int, err error) {
+	var count atomic.Int64
+	for _, method := range publishMethods {
+		m.OnCall(method, func(Call) error {
+			if count.Add(1) == int64(n) {
+				return err
+			}
+			return nil
+		})
+	}
+}
+
+// FailTarget makes every call to method about target fail with err, e.g.
+// "QueueDeclare" of a given queue or "PublishWithOptions" to an exchange.
+func (m *MockChannel) FailTarget(method, target string, err error) {
+	m.OnCall(method, func(call Call) error {
+		if call.Target == target {
+			return err
+		}
+		return nil
+	})
+}
+
+// Calls returns every call recorded so far, in order.
+func (m *MockChannel) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// CallsTo returns the recorded calls to method.
+func (m *MockChannel) CallsTo(method string) []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var calls []Call
+	for _, c := range m.calls {
+		if c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// Published returns the messages published so far.
+func (m *MockChannel) Published() []PublishedMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]PublishedMessage(nil), m.PublishedMessages...)
+}
+
+// WaitForPublished waits until at least n messages were published and
+// returns them, or fails once timeout passes.
+func (m *MockChannel) WaitForPublished(n int, timeout time.Duration) ([]PublishedMessage, error) {
+	var published []PublishedMessage
+	ok := m.wait(timeout, func() bool {
+		published = append([]PublishedMessage(nil), m.PublishedMessages...)
+		return len(published) >= n
+	})
+	if !ok {
+		return published, fmt.Errorf("mocks: %d of %d messages published after %s", len(published), n, timeout)
+	}
+	return published, nil
+}
+
+// WaitForCalls waits until method was called at least n times and returns
+// those calls, or fails once timeout passes.
+func (m *MockChannel) WaitForCalls(method string, n int, timeout time.Duration) ([]Call, error) {
+	var calls []Call
+	ok := m.wait(timeout, func() bool {
+		calls = calls[:0]
+		for _, c := range m.calls {
+			if c.Method == method {
+				calls = append(calls, c)
+			}
+		}
+		return len(calls) >= n
+	})
+	if !ok {
+		return calls, fmt.Errorf("mocks: %d of %d %s calls after %s", len(calls), n, method, timeout)
+	}
+	return calls, nil
+}
+
+// wait evaluates cond with m.mu held every time a call or publish is
+// recorded, until it holds or timeout passes.
+func (m *MockChannel) wait(timeout time.Duration, cond func() bool) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		m.mu.Lock()
+		if cond() {
+			m.mu.Unlock()
+			return true
+		}
+		if m.changed == nil {
+			m.changed = make(chan struct{})
+		}
+		changed := m.changed
+		m.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline.C:
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			return cond()
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package mocks
 
 import (
+	"context"
+	"slices"
+	"sync"
+
 	"github.com/eugene-ruby/xconnect/rabbitmq"
 )
 
@@ -8,17 +12,84 @@ import (
 type PublishedMessage struct {
 	Exchange   string
 	RoutingKey string
+	Mandatory  bool
+	Immediate  bool
 	Body       []byte
+
+	// DeliveryTag is the publish sequence number, set only in confirm mode.
+	DeliveryTag uint64
+
+	// Publishing holds every property of the published message, including Body.
+	Publishing rabbitmq.Publishing
+}
+
+// Settlement represents a captured Ack, Nack or Reject call in the mock.
+type Settlement struct {
+	DeliveryTag uint64
+	Multiple    bool
+	Requeue     bool
+}
+
+// QosSetting represents a captured Qos call in the mock.
+type QosSetting struct {
+	PrefetchCount int
+	PrefetchSize  int
+	Global        bool
 }
 
 // MockChannel is a mock implementation of rabbitmq.Channel used for unit tests.
+//
+// It is safe for concurrent use. Every Channel call is recorded (see Calls)
+// and can be failed by a script (see OnCall). The exported fields may be set
+// before use; while the mock is in use, read them through Published, Calls
+// and the other accessors instead.
 type MockChannel struct {
 	PublishedMessages []PublishedMessage
 	ConsumeMessages   chan rabbitmq.Delivery
 	ConsumeErr        error
 	PublishErr        error
-	CancelCalled bool
-	CancelArgs   []string
+	CancelCalled      bool
+	CancelArgs        []string
+
+	// ConfirmFunc decides whether each publish made in confirm mode is acked
+	// (true) or nacked (false). When nil, no confirmations are sent
+	// automatically and tests script them with SendConfirmation.
+	ConfirmFunc func(msg PublishedMessage) bool
+
+	// ReturnFunc reports whether a mandatory publish is unroutable. Returned
+	// publishes are sent to NotifyReturn listeners with ReplyNoRoute before
+	// their confirmation.
+	ReturnFunc func(msg PublishedMessage) bool
+
+	// GetMessages holds the messages Get returns, by queue name. Messages
+	// fetched without autoAck go back to the front of their queue when nacked
+	// or rejected with requeue.
+	GetMessages map[string][]rabbitmq.Delivery
+
+	mu        sync.Mutex
+	calls     []Call
+	counts    map[string]int
+	hooks     map[string][]func(Call) error
+	changed   chan struct{} // closed and replaced whenever a call or publish is recorded
+	nextTag   uint64
+	consumers map[string]chan struct{}
+	acked     []Settlement
+	nacked    []Settlement
+	rejected  []Settlement
+	qos       []QosSetting
+	unacked   map[uint64]unackedGet
+
+	confirming bool
+	publishTag uint64
+	listeners  []chan rabbitmq.Confirmation
+	returns    []chan rabbitmq.Return
+	closed     bool
+}
+
+// unackedGet is a message fetched with Get that was not settled yet.
+type unackedGet struct {
+	queue string
+	msg   rabbitmq.Delivery
 }
 
 // NewMockChannel creates a new MockChannel instance.
@@ -30,44 +101,410 @@ func NewMockChannel() *MockChannel {
 }
 
 func (m *MockChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args rabbitmq.Table) error {
-	return nil
+	return m.record("ExchangeDeclare", name, name, kind, durable, autoDelete, internal, noWait, args)
 }
 
 func (m *MockChannel) Publish(exchange, routingKey string, body []byte) error {
-	if m.PublishErr != nil {
-		return m.PublishErr
+	if err := m.record("Publish", exchange, exchange, routingKey, body); err != nil {
+		return err
+	}
+	return m.publish(exchange, routingKey, false, false, rabbitmq.Publishing{
+		ContentType: "application/octet-stream",
+		Body:        body,
+	})
+}
+
+func (m *MockChannel) PublishWithOptions(exchange, routingKey string, mandatory, immediate bool, msg rabbitmq.Publishing) error {
+	if err := m.record("PublishWithOptions", exchange, exchange, routingKey, mandatory, immediate, msg); err != nil {
+		return err
+	}
+	return m.publish(exchange, routingKey, mandatory, immediate, msg)
+}
+
+// publish captures a publish that was not failed by a script.
+func (m *MockChannel) publish(exchange, routingKey string, mandatory, immediate bool, msg rabbitmq.Publishing) error {
+	m.mu.Lock()
+	publishErr := m.PublishErr
+	m.mu.Unlock()
+	if publishErr != nil {
+		return publishErr
 	}
-	m.PublishedMessages = append(m.PublishedMessages, PublishedMessage{
+
+	published := PublishedMessage{
 		Exchange:   exchange,
 		RoutingKey: routingKey,
-		Body:       body,
-	})
+		Mandatory:  mandatory,
+		Immediate:  immediate,
+		Body:       msg.Body,
+		Publishing: msg,
+	}
+
+	m.mu.Lock()
+	if m.confirming {
+		m.publishTag++
+		published.DeliveryTag = m.publishTag
+	}
+	m.PublishedMessages = append(m.PublishedMessages, published)
+	confirming := m.confirming
+	m.broadcast()
+	m.mu.Unlock()
+
+	if mandatory && m.ReturnFunc != nil && m.ReturnFunc(published) {
+		m.SendReturn(returnOf(published))
+	}
+	if confirming && m.ConfirmFunc != nil {
+		m.SendConfirmation(rabbitmq.Confirmation{
+			DeliveryTag: published.DeliveryTag,
+			Ack:         m.ConfirmFunc(published),
+		})
+	}
+	return nil
+}
+
+func (m *MockChannel) PublishWithContext(ctx context.Context, exchange, routingKey string, mandatory, immediate bool, msg rabbitmq.Publishing) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := m.record("PublishWithContext", exchange, ctx, exchange, routingKey, mandatory, immediate, msg); err != nil {
+		return err
+	}
+	return m.publish(exchange, routingKey, mandatory, immediate, msg)
+}
+
+// Confirm puts the mock into confirm mode; subsequent publishes get delivery tags.
+func (m *MockChannel) Confirm(noWait bool) error {
+	if err := m.record("Confirm", "", noWait); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.confirming = true
 	return nil
 }
 
+// NotifyPublish registers a listener for confirmations. It is closed by Close.
+func (m *MockChannel) NotifyPublish(confirm chan rabbitmq.Confirmation) chan rabbitmq.Confirmation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, confirm)
+	return confirm
+}
+
+// SendConfirmation delivers c to every NotifyPublish listener, simulating a broker ack or nack.
+func (m *MockChannel) SendConfirmation(c rabbitmq.Confirmation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, l := range m.listeners {
+		l <- c
+	}
+}
+
 func (m *MockChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args rabbitmq.Table) (rabbitmq.Queue, error) {
+	if err := m.record("QueueDeclare", name, name, durable, autoDelete, exclusive, noWait, args); err != nil {
+		return rabbitmq.Queue{}, err
+	}
 	return rabbitmq.Queue{Name: name}, nil
 }
 
 func (m *MockChannel) QueueBind(name, key, exchange string, noWait bool, args rabbitmq.Table) error {
+	return m.record("QueueBind", name, name, key, exchange, noWait, args)
+}
+
+func (m *MockChannel) ExchangeBind(destination, key, source string, noWait bool, args rabbitmq.Table) error {
+	return m.record("ExchangeBind", destination, destination, key, source, noWait, args)
+}
+
+func (m *MockChannel) ExchangeUnbind(destination, key, source string, noWait bool, args rabbitmq.Table) error {
+	return m.record("ExchangeUnbind", destination, destination, key, source, noWait, args)
+}
+
+func (m *MockChannel) ExchangeDelete(name string, ifUnused, noWait bool) error {
+	return m.record("ExchangeDelete", name, name, ifUnused, noWait)
+}
+
+func (m *MockChannel) QueueUnbind(name, key, exchange string, args rabbitmq.Table) error {
+	return m.record("QueueUnbind", name, name, key, exchange, args)
+}
+
+// QueueInspect reports the number of messages in GetMessages[name].
+func (m *MockChannel) QueueInspect(name string) (rabbitmq.Queue, error) {
+	if err := m.record("QueueInspect", name, name); err != nil {
+		return rabbitmq.Queue{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return rabbitmq.Queue{Name: name, Messages: len(m.GetMessages[name])}, nil
+}
+
+// QueueDelete drops GetMessages[name] and returns how many messages it held.
+func (m *MockChannel) QueueDelete(name string, ifUnused, ifEmpty, noWait bool) (int, error) {
+	if err := m.record("QueueDelete", name, name, ifUnused, ifEmpty, noWait); err != nil {
+		return 0, err
+	}
+	return m.purge(name), nil
+}
+
+// QueuePurge removes every message from GetMessages[name] and returns how many there were.
+func (m *MockChannel) QueuePurge(name string, noWait bool) (int, error) {
+	if err := m.record("QueuePurge", name, name, noWait); err != nil {
+		return 0, err
+	}
+	return m.purge(name), nil
+}
+
+func (m *MockChannel) purge(name string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := len(m.GetMessages[name])
+	delete(m.GetMessages, name)
+	return n
+}
+
+// Get pops the first message of GetMessages[queue] with the mock attached as
+// its Acknowledger and MessageCount set to the messages left.
+func (m *MockChannel) Get(queue string, autoAck bool) (rabbitmq.Delivery, bool, error) {
+	if err := m.record("Get", queue, queue, autoAck); err != nil {
+		return rabbitmq.Delivery{}, false, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msgs := m.GetMessages[queue]
+	if len(msgs) == 0 {
+		return rabbitmq.Delivery{}, false, nil
+	}
+	msg := msgs[0]
+	m.GetMessages[queue] = msgs[1:]
+
+	m.nextTag++
+	msg.DeliveryTag = m.nextTag
+	msg.MessageCount = uint32(len(msgs) - 1)
+	msg.Acknowledger = m
+	if !autoAck {
+		if m.unacked == nil {
+			m.unacked = make(map[uint64]unackedGet)
+		}
+		m.unacked[msg.DeliveryTag] = unackedGet{queue: queue, msg: msg}
+	}
+	return msg, true, nil
+}
+
+// settleGets forgets the fetched messages covered by tag and puts them back
+// in their queues when requeue is set. Called with m.mu held.
+func (m *MockChannel) settleGets(tag uint64, multiple, requeue bool) {
+	var tags []uint64
+	for t := range m.unacked {
+		if t == tag || (multiple && t < tag) {
+			tags = append(tags, t)
+		}
+	}
+	slices.Sort(tags)
+	for i := len(tags) - 1; i >= 0; i-- {
+		got := m.unacked[tags[i]]
+		delete(m.unacked, tags[i])
+		if requeue {
+			got.msg.Redelivered = true
+			m.GetMessages[got.queue] = append([]rabbitmq.Delivery{got.msg}, m.GetMessages[got.queue]...)
+		}
+	}
+}
+
+// Qos records the prefetch settings.
+func (m *MockChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	if err := m.record("Qos", "", prefetchCount, prefetchSize, global); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.qos = append(m.qos, QosSetting{PrefetchCount: prefetchCount, PrefetchSize: prefetchSize, Global: global})
 	return nil
 }
 
+// Consume returns deliveries pushed into ConsumeMessages with the mock attached
+// as their Acknowledger. Metadata set on the pushed delivery is passed through
+// unchanged; the delivery and consumer tags are filled in when left empty.
 func (m *MockChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args rabbitmq.Table) (<-chan rabbitmq.Delivery, error) {
+	if err := m.record("Consume", queue, queue, consumer, autoAck, exclusive, noLocal, noWait, args); err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	m.mu.Lock()
 	if m.ConsumeErr != nil {
+		m.mu.Unlock()
 		return nil, m.ConsumeErr
 	}
-	return m.ConsumeMessages, nil
+	if m.consumers == nil {
+		m.consumers = make(map[string]chan struct{})
+	}
+	m.consumers[consumer] = done
+	m.mu.Unlock()
+
+	out := make(chan rabbitmq.Delivery)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-done:
+				return
+			case msg, ok := <-m.ConsumeMessages:
+				if !ok {
+					return
+				}
+				m.mu.Lock()
+				m.nextTag++
+				if msg.DeliveryTag == 0 {
+					msg.DeliveryTag = m.nextTag
+				}
+				if msg.ConsumerTag == "" {
+					msg.ConsumerTag = consumer
+				}
+				m.mu.Unlock()
+				msg.Acknowledger = m
+				select {
+				case out <- msg:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
 }
 
+// NotifyReturn registers a listener for returned messages. It is closed by Close.
+func (m *MockChannel) NotifyReturn(c chan rabbitmq.Return) chan rabbitmq.Return {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.returns = append(m.returns, c)
+	return c
+}
+
+// SendReturn delivers r to every NotifyReturn listener, simulating an unroutable message.
+func (m *MockChannel) SendReturn(r rabbitmq.Return) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.returns {
+		c <- r
+	}
+}
+
+// returnOf builds the Return the broker sends for an unroutable publish.
+func returnOf(msg PublishedMessage) rabbitmq.Return {
+	return rabbitmq.Return{
+		ReplyCode:       rabbitmq.ReplyNoRoute,
+		ReplyText:       "NO_ROUTE",
+		Exchange:        msg.Exchange,
+		RoutingKey:      msg.RoutingKey,
+		Headers:         msg.Publishing.Headers,
+		ContentType:     msg.Publishing.ContentType,
+		ContentEncoding: msg.Publishing.ContentEncoding,
+		DeliveryMode:    msg.Publishing.DeliveryMode,
+		Priority:        msg.Publishing.Priority,
+		CorrelationID:   msg.Publishing.CorrelationID,
+		ReplyTo:         msg.Publishing.ReplyTo,
+		Expiration:      msg.Publishing.Expiration,
+		MessageID:       msg.Publishing.MessageID,
+		Timestamp:       msg.Publishing.Timestamp,
+		Type:            msg.Publishing.Type,
+		UserID:          msg.Publishing.UserID,
+		AppID:           msg.Publishing.AppID,
+		Body:            msg.Body,
+	}
+}
+
+// Close closes every NotifyPublish and NotifyReturn listener.
 func (m *MockChannel) Close() error {
+	if err := m.record("Close", ""); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.closed {
+		for _, l := range m.listeners {
+			close(l)
+		}
+		for _, c := range m.returns {
+			close(c)
+		}
+		m.listeners = nil
+		m.returns = nil
+		m.closed = true
+	}
 	return nil
 }
 
+// Cancel records the call and stops the matching consumer.
 func (m *MockChannel) Cancel(consumer string, noWait bool) error {
+	if err := m.record("Cancel", consumer, consumer, noWait); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.CancelCalled = true
 	m.CancelArgs = append(m.CancelArgs, consumer)
+	if done, ok := m.consumers[consumer]; ok {
+		close(done)
+		delete(m.consumers, consumer)
+	}
 	return nil
 }
 
-var _ rabbitmq.Channel = (*MockChannel)(nil)
+// Ack records an acknowledgement.
+func (m *MockChannel) Ack(tag uint64, multiple bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.acked = append(m.acked, Settlement{DeliveryTag: tag, Multiple: multiple})
+	m.settleGets(tag, multiple, false)
+	return nil
+}
+
+// Nack records a negative acknowledgement.
+func (m *MockChannel) Nack(tag uint64, multiple bool, requeue bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nacked = append(m.nacked, Settlement{DeliveryTag: tag, Multiple: multiple, Requeue: requeue})
+	m.settleGets(tag, multiple, requeue)
+	return nil
+}
+
+// Reject records a rejection.
+func (m *MockChannel) Reject(tag uint64, requeue bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rejected = append(m.rejected, Settlement{DeliveryTag: tag, Requeue: requeue})
+	m.settleGets(tag, false, requeue)
+	return nil
+}
+
+// Acked returns the deliveries acknowledged so far.
+func (m *MockChannel) Acked() []Settlement {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Settlement(nil), m.acked...)
+}
+
+// Nacked returns the deliveries negatively acknowledged so far.
+func (m *MockChannel) Nacked() []Settlement {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Settlement(nil), m.nacked...)
+}
+
+// Rejected returns the deliveries rejected so far.
+func (m *MockChannel) Rejected() []Settlement {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Settlement(nil), m.rejected...)
+}
+
+// QosSettings returns the Qos calls made so far.
+func (m *MockChannel) QosSettings() []QosSetting {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]QosSetting(nil), m.qos...)
+}
+
+var (
+	_ rabbitmq.Channel      = (*MockChannel)(nil)
+	_ rabbitmq.Acknowledger = (*MockChannel)(nil)
+)
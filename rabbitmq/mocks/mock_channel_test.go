@@ -1,7 +1,10 @@
 package mocks_test
 
 import (
+	"context"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/eugene-ruby/xconnect/rabbitmq"
 	"github.com/eugene-ruby/xconnect/rabbitmq/mocks"
@@ -22,6 +25,79 @@ func TestMockChannel_PublishCapture(t *testing.T) {
 	require.Equal(t, []byte("hello world"), msg.Body)
 }
 
+func TestMockChannel_PublishWithOptionsCapture(t *testing.T) {
+	mock := mocks.NewMockChannel()
+
+	msg := rabbitmq.Publishing{
+		Headers:       rabbitmq.Table{"tenant": "acme"},
+		ContentType:   "application/json",
+		DeliveryMode:  rabbitmq.Persistent,
+		CorrelationID: "corr-1",
+		ReplyTo:       "replies",
+		Expiration:    "60000",
+		Priority:      4,
+		Body:          []byte(`{"id":1}`),
+	}
+
+	err := mock.PublishWithOptions("orders", "order.created", true, false, msg)
+	require.NoError(t, err)
+
+	require.Len(t, mock.PublishedMessages, 1)
+
+	got := mock.PublishedMessages[0]
+	require.Equal(t, "orders", got.Exchange)
+	require.Equal(t, "order.created", got.RoutingKey)
+	require.True(t, got.Mandatory)
+	require.False(t, got.Immediate)
+	require.Equal(t, msg.Body, got.Body)
+	require.Equal(t, msg, got.Publishing)
+}
+
+func TestMockChannel_ScriptedConfirmations(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	mock.ConfirmFunc = func(msg mocks.PublishedMessage) bool {
+		return msg.RoutingKey != "rejected"
+	}
+
+	require.NoError(t, mock.Confirm(false))
+	confirms := mock.NotifyPublish(make(chan rabbitmq.Confirmation, 2))
+
+	require.NoError(t, mock.Publish("ex", "accepted", []byte("one")))
+	require.NoError(t, mock.Publish("ex", "rejected", []byte("two")))
+
+	require.Equal(t, rabbitmq.Confirmation{DeliveryTag: 1, Ack: true}, <-confirms)
+	require.Equal(t, rabbitmq.Confirmation{DeliveryTag: 2, Ack: false}, <-confirms)
+	require.Equal(t, uint64(2), mock.PublishedMessages[1].DeliveryTag)
+
+	require.NoError(t, mock.Close())
+	_, open := <-confirms
+	require.False(t, open)
+}
+
+func TestMockChannel_SimulatedReturns(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	mock.ReturnFunc = func(msg mocks.PublishedMessage) bool {
+		return msg.RoutingKey == "unbound"
+	}
+
+	returns := mock.NotifyReturn(make(chan rabbitmq.Return, 1))
+
+	require.NoError(t, mock.PublishWithOptions("ex", "unbound", false, false, rabbitmq.Publishing{Body: []byte("not mandatory")}))
+	require.NoError(t, mock.PublishWithOptions("ex", "unbound", true, false, rabbitmq.Publishing{
+		MessageID: "msg-1",
+		Body:      []byte("mandatory"),
+	}))
+
+	r := <-returns
+	require.Equal(t, rabbitmq.ReplyNoRoute, r.ReplyCode)
+	require.Equal(t, "unbound", r.RoutingKey)
+	require.Equal(t, "msg-1", r.MessageID)
+	require.Equal(t, []byte("mandatory"), r.Body)
+
+	mock.SendReturn(rabbitmq.Return{ReplyCode: rabbitmq.ReplyNoConsumers})
+	require.Equal(t, rabbitmq.ReplyNoConsumers, (<-returns).ReplyCode)
+}
+
 func TestMockChannel_ConsumeSuccess(t *testing.T) {
 	mock := mocks.NewMockChannel()
 
@@ -37,6 +113,51 @@ func TestMockChannel_ConsumeSuccess(t *testing.T) {
 	require.Equal(t, expected.Body, msg.Body)
 }
 
+func TestMockChannel_RecordsSettlements(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	mock.ConsumeMessages <- rabbitmq.Delivery{Body: []byte("one")}
+	mock.ConsumeMessages <- rabbitmq.Delivery{Body: []byte("two")}
+	mock.ConsumeMessages <- rabbitmq.Delivery{Body: []byte("three")}
+
+	ch, err := mock.Consume("queue", "consumer", false, false, false, false, nil)
+	require.NoError(t, err)
+
+	first, second, third := <-ch, <-ch, <-ch
+	require.NoError(t, first.Ack())
+	require.NoError(t, second.Nack(true))
+	require.NoError(t, third.Reject(false))
+
+	require.Equal(t, []mocks.Settlement{{DeliveryTag: first.DeliveryTag}}, mock.Acked())
+	require.Equal(t, []mocks.Settlement{{DeliveryTag: second.DeliveryTag, Requeue: true}}, mock.Nacked())
+	require.Equal(t, []mocks.Settlement{{DeliveryTag: third.DeliveryTag}}, mock.Rejected())
+	require.NotEqual(t, first.DeliveryTag, second.DeliveryTag)
+}
+
+func TestMockChannel_ConsumePassesMetadata(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	mock.ConsumeMessages <- rabbitmq.Delivery{
+		Headers:     rabbitmq.Table{"tenant": "acme"},
+		ContentType: "application/json",
+		MessageID:   "msg-1",
+		Exchange:    "orders",
+		RoutingKey:  "order.created",
+		Redelivered: true,
+	}
+
+	ch, err := mock.Consume("queue", "consumer", false, false, false, false, nil)
+	require.NoError(t, err)
+
+	msg := <-ch
+	require.Equal(t, rabbitmq.Table{"tenant": "acme"}, msg.Headers)
+	require.Equal(t, "application/json", msg.ContentType)
+	require.Equal(t, "msg-1", msg.MessageID)
+	require.Equal(t, "orders", msg.Exchange)
+	require.Equal(t, "order.created", msg.RoutingKey)
+	require.True(t, msg.Redelivered)
+	require.Equal(t, "consumer", msg.ConsumerTag)
+	require.NotZero(t, msg.DeliveryTag)
+}
+
 func TestMockChannel_ConsumeError(t *testing.T) {
 	mock := mocks.NewMockChannel()
 	mock.ConsumeErr = errFake("consume error")
@@ -81,3 +202,177 @@ type errFake string
 func (e errFake) Error() string {
 	return string(e)
 }
+
+func TestMockChannel_RecordsQos(t *testing.T) {
+	mock := mocks.NewMockChannel()
+
+	require.NoError(t, mock.Qos(10, 0, false))
+	require.NoError(t, mock.Qos(1, 0, true))
+
+	require.Equal(t, []mocks.QosSetting{
+		{PrefetchCount: 10},
+		{PrefetchCount: 1, Global: true},
+	}, mock.QosSettings())
+}
+
+func TestMockChannel_GetRequeuesUnsettled(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	mock.GetMessages = map[string][]rabbitmq.Delivery{
+		"queue": {{MessageID: "1"}, {MessageID: "2"}},
+	}
+
+	first, ok, err := mock.Get("queue", false)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "1", first.MessageID)
+	require.Equal(t, uint32(1), first.MessageCount)
+
+	require.NoError(t, first.Nack(true))
+	again, _, _ := mock.Get("queue", false)
+	require.Equal(t, "1", again.MessageID)
+	require.True(t, again.Redelivered)
+
+	require.NoError(t, again.Ack())
+	n, err := mock.QueuePurge("queue", false)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	_, ok, err = mock.Get("queue", false)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestMockChannel_QueueInspectAndDelete(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	mock.GetMessages = map[string][]rabbitmq.Delivery{
+		"queue": {{MessageID: "1"}, {MessageID: "2"}},
+	}
+
+	q, err := mock.QueueInspect("queue")
+	require.NoError(t, err)
+	require.Equal(t, rabbitmq.Queue{Name: "queue", Messages: 2}, q)
+
+	require.NoError(t, mock.QueueUnbind("queue", "key", "exchange", nil))
+	require.NoError(t, mock.ExchangeBind("dest", "key", "source", false, nil))
+	require.NoError(t, mock.ExchangeUnbind("dest", "key", "source", false, nil))
+	require.NoError(t, mock.ExchangeDelete("exchange", false, false))
+	require.Equal(t, []mocks.Call{{
+		Method: "QueueUnbind", N: 1, Target: "queue", Args: []interface{}{"queue", "key", "exchange", rabbitmq.Table(nil)},
+	}}, mock.CallsTo("QueueUnbind"))
+	require.Equal(t, []mocks.Call{{
+		Method: "ExchangeUnbind", N: 1, Target: "dest", Args: []interface{}{"dest", "key", "source", false, rabbitmq.Table(nil)},
+	}}, mock.CallsTo("ExchangeUnbind"))
+	require.Equal(t, []mocks.Call{{
+		Method: "ExchangeDelete", N: 1, Target: "exchange", Args: []interface{}{"exchange", false, false},
+	}}, mock.CallsTo("ExchangeDelete"))
+
+	n, err := mock.QueueDelete("queue", false, false, false)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	q, err = mock.QueueInspect("queue")
+	require.NoError(t, err)
+	require.Zero(t, q.Messages)
+}
+
+func TestMockChannel_ConcurrentPublishAndWait(t *testing.T) {
+	mock := mocks.NewMockChannel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_ = mock.Publish("exchange", "key", []byte("test"))
+			}
+		}()
+	}
+
+	published, err := mock.WaitForPublished(80, time.Second)
+	require.NoError(t, err)
+	require.Len(t, published, 80)
+	wg.Wait()
+
+	_, err = mock.WaitForPublished(81, 10*time.Millisecond)
+	require.EqualError(t, err, "mocks: 80 of 81 messages published after 10ms")
+}
+
+func TestMockChannel_RecordsCalls(t *testing.T) {
+	mock := mocks.NewMockChannel()
+
+	require.NoError(t, mock.ExchangeDeclare("orders", "topic", true, false, false, false, nil))
+	_, err := mock.QueueDeclare("orders.created", true, false, false, false, rabbitmq.Table{"x-queue-type": "quorum"})
+	require.NoError(t, err)
+	require.NoError(t, mock.QueueBind("orders.created", "order.created", "orders", false, nil))
+	_, err = mock.Consume("orders.created", "worker", false, false, false, false, nil)
+	require.NoError(t, err)
+	require.NoError(t, mock.Cancel("worker", false))
+	require.NoError(t, mock.Close())
+
+	var methods []string
+	for _, c := range mock.Calls() {
+		methods = append(methods, c.Method)
+	}
+	require.Equal(t, []string{"ExchangeDeclare", "QueueDeclare", "QueueBind", "Consume", "Cancel", "Close"}, methods)
+	require.Equal(t, []mocks.Call{{
+		Method: "QueueDeclare",
+		N:      1,
+		Target: "orders.created",
+		Args:   []interface{}{"orders.created", true, false, false, false, rabbitmq.Table{"x-queue-type": "quorum"}},
+	}}, mock.CallsTo("QueueDeclare"))
+}
+
+func TestMockChannel_ScriptedFailures(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	unavailable := errFake("channel unavailable")
+	mock.FailNth("Publish", 3, unavailable)
+	mock.FailTarget("QueueDeclare", "payments", errFake("precondition failed"))
+
+	for i := 1; i <= 4; i++ {
+		err := mock.Publish("exchange", "key", []byte{byte(i)})
+		if i == 3 {
+			require.ErrorIs(t, err, unavailable)
+		} else {
+			require.NoError(t, err)
+		}
+	}
+	require.Len(t, mock.Published(), 3)
+	require.Len(t, mock.CallsTo("Publish"), 4)
+
+	_, err := mock.QueueDeclare("orders", true, false, false, false, nil)
+	require.NoError(t, err)
+	_, err = mock.QueueDeclare("payments", true, false, false, false, nil)
+	require.EqualError(t, err, "precondition failed")
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		_ = mock.Cancel("worker", false)
+	}()
+	calls, err := mock.WaitForCalls("Cancel", 1, time.Second)
+	require.NoError(t, err)
+	require.Equal(t, "worker", calls[0].Target)
+}
+
+func TestMockChannel_FailNthCountsPerMethod(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	unavailable := errFake("channel unavailable")
+	mock.FailNth("PublishWithOptions", 2, unavailable)
+
+	require.NoError(t, mock.Publish("exchange", "key", nil))
+	require.NoError(t, mock.PublishWithOptions("exchange", "key", false, false, rabbitmq.Publishing{}))
+	require.NoError(t, mock.PublishWithContext(context.Background(), "exchange", "key", false, false, rabbitmq.Publishing{}))
+	require.ErrorIs(t, mock.PublishWithOptions("exchange", "key", false, false, rabbitmq.Publishing{}), unavailable)
+}
+
+func TestMockChannel_FailNthPublish(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	unavailable := errFake("channel unavailable")
+	mock.FailNthPublish(3, unavailable)
+
+	require.NoError(t, mock.Publish("exchange", "key", nil))
+	require.NoError(t, mock.PublishWithOptions("exchange", "key", false, false, rabbitmq.Publishing{}))
+	require.ErrorIs(t, mock.PublishWithContext(context.Background(), "exchange", "key", false, false, rabbitmq.Publishing{}), unavailable)
+	require.NoError(t, mock.PublishWithOptions("exchange", "key", false, false, rabbitmq.Publishing{}))
+	require.Len(t, mock.Published(), 3)
+}
@@ -1,25 +1,125 @@
 package rabbitmq
 
+import (
+	"context"
+	"sync"
+)
+
 // mockChannel is a mock implementation of the Channel interface.
 
 type mockChannel struct {
-	messages   chan Delivery
-	consumeErr error
-	published  bool
-	closed     bool
-	publishErr error
-	closeErr   error
+	messages     chan Delivery
+	consumeErr   error
+	published    bool
+	closed       bool
+	publishErr   error
+	lastPublish  mockPublish
+	closeErr     error
 	CancelCalled bool
 	CancelArgs   []string
+
+	mu        sync.Mutex
+	nextTag   uint64
+	consumers map[string]chan struct{}
+	acked     []uint64
+	nacked    []uint64
+	rejected  []uint64
+	requeued  []uint64
+
+	prefetchCount int
+	prefetchSize  int
+	qosGlobal     bool
+
+	confirming  bool
+	confirmFunc func(tag uint64) bool // acks or nacks each publish in confirm mode when set
+	publishTag  uint64
+	listeners   []chan Confirmation
+	returnFunc  func(exchange, routingKey string) bool // returns mandatory publishes as unroutable when set
+	returns     []chan Return
 }
 
 func (m *mockChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args Table) error {
 	return nil
 }
 
+// mockPublish captures the arguments of the last publish call.
+type mockPublish struct {
+	exchange   string
+	routingKey string
+	mandatory  bool
+	immediate  bool
+	msg        Publishing
+}
+
 func (m *mockChannel) Publish(exchange, routingKey string, body []byte) error {
+	return m.PublishWithOptions(exchange, routingKey, false, false, Publishing{Body: body})
+}
+
+func (m *mockChannel) PublishWithOptions(exchange, routingKey string, mandatory, immediate bool, msg Publishing) error {
+	m.mu.Lock()
 	m.published = true
-	return m.publishErr
+	m.lastPublish = mockPublish{
+		exchange:   exchange,
+		routingKey: routingKey,
+		mandatory:  mandatory,
+		immediate:  immediate,
+		msg:        msg,
+	}
+	if m.publishErr != nil {
+		m.mu.Unlock()
+		return m.publishErr
+	}
+	confirming := m.confirming
+	if confirming {
+		m.publishTag++
+	}
+	tag := m.publishTag
+	m.mu.Unlock()
+
+	if mandatory && m.returnFunc != nil && m.returnFunc(exchange, routingKey) {
+		m.sendReturn(Return{
+			ReplyCode:  ReplyNoRoute,
+			ReplyText:  "NO_ROUTE",
+			Exchange:   exchange,
+			RoutingKey: routingKey,
+			Headers:    msg.Headers,
+			Body:       msg.Body,
+		})
+	}
+	if confirming && m.confirmFunc != nil {
+		m.sendConfirmation(Confirmation{DeliveryTag: tag, Ack: m.confirmFunc(tag)})
+	}
+	return nil
+}
+
+func (m *mockChannel) PublishWithContext(ctx context.Context, exchange, routingKey string, mandatory, immediate bool, msg Publishing) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return m.PublishWithOptions(exchange, routingKey, mandatory, immediate, msg)
+}
+
+func (m *mockChannel) Confirm(noWait bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.confirming = true
+	return nil
+}
+
+func (m *mockChannel) NotifyPublish(confirm chan Confirmation) chan Confirmation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, confirm)
+	return confirm
+}
+
+// sendConfirmation delivers c to every NotifyPublish listener.
+func (m *mockChannel) sendConfirmation(c Confirmation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, l := range m.listeners {
+		l <- c
+	}
 }
 
 func (m *mockChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args Table) (Queue, error) {
@@ -30,22 +130,166 @@ func (m *mockChannel) QueueBind(name, key, exchange string, noWait bool, args Ta
 	return nil
 }
 
+func (m *mockChannel) ExchangeBind(destination, key, source string, noWait bool, args Table) error {
+	return nil
+}
+
+func (m *mockChannel) ExchangeUnbind(destination, key, source string, noWait bool, args Table) error {
+	return nil
+}
+
+func (m *mockChannel) ExchangeDelete(name string, ifUnused, noWait bool) error {
+	return nil
+}
+
+func (m *mockChannel) QueueUnbind(name, key, exchange string, args Table) error {
+	return nil
+}
+
+func (m *mockChannel) QueueInspect(name string) (Queue, error) {
+	return Queue{Name: name}, nil
+}
+
+func (m *mockChannel) QueueDelete(name string, ifUnused, ifEmpty, noWait bool) (int, error) {
+	return 0, nil
+}
+
+func (m *mockChannel) QueuePurge(name string, noWait bool) (int, error) {
+	return 0, nil
+}
+
+func (m *mockChannel) Get(queue string, autoAck bool) (Delivery, bool, error) {
+	return Delivery{}, false, nil
+}
+
+func (m *mockChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prefetchCount = prefetchCount
+	m.prefetchSize = prefetchSize
+	m.qosGlobal = global
+	return nil
+}
+
+// Consume forwards messages to the caller, attaching the mock as Acknowledger.
 func (m *mockChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args Table) (<-chan Delivery, error) {
 	if m.consumeErr != nil {
 		return nil, m.consumeErr
 	}
-	return m.messages, nil
+
+	done := make(chan struct{})
+	m.mu.Lock()
+	if m.consumers == nil {
+		m.consumers = make(map[string]chan struct{})
+	}
+	m.consumers[consumer] = done
+	m.mu.Unlock()
+
+	out := make(chan Delivery)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-done:
+				return
+			case msg, ok := <-m.messages:
+				if !ok {
+					return
+				}
+				m.mu.Lock()
+				m.nextTag++
+				if msg.DeliveryTag == 0 {
+					msg.DeliveryTag = m.nextTag
+				}
+				if msg.ConsumerTag == "" {
+					msg.ConsumerTag = consumer
+				}
+				m.mu.Unlock()
+				msg.Acknowledger = m
+				select {
+				case out <- msg:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (m *mockChannel) NotifyReturn(c chan Return) chan Return {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.returns = append(m.returns, c)
+	return c
+}
+
+// sendReturn delivers r to every NotifyReturn listener.
+func (m *mockChannel) sendReturn(r Return) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.returns {
+		c <- r
+	}
 }
 
 func (m *mockChannel) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.closed {
+		for _, l := range m.listeners {
+			close(l)
+		}
+		for _, c := range m.returns {
+			close(c)
+		}
+		m.listeners = nil
+		m.returns = nil
+	}
 	m.closed = true
 	return m.closeErr
 }
 
 func (m *mockChannel) Cancel(consumer string, noWait bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.CancelCalled = true
 	m.CancelArgs = append(m.CancelArgs, consumer)
+	if done, ok := m.consumers[consumer]; ok {
+		close(done)
+		delete(m.consumers, consumer)
+	}
+	return nil
+}
+
+func (m *mockChannel) Ack(tag uint64, multiple bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.acked = append(m.acked, tag)
+	return nil
+}
+
+func (m *mockChannel) Nack(tag uint64, multiple bool, requeue bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nacked = append(m.nacked, tag)
+	if requeue {
+		m.requeued = append(m.requeued, tag)
+	}
+	return nil
+}
+
+func (m *mockChannel) Reject(tag uint64, requeue bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rejected = append(m.rejected, tag)
+	if requeue {
+		m.requeued = append(m.requeued, tag)
+	}
 	return nil
 }
 
-var _ Channel = (*mockChannel)(nil)
+var (
+	_ Channel      = (*mockChannel)(nil)
+	_ Acknowledger = (*mockChannel)(nil)
+)
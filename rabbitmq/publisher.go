@@ -1,18 +1,125 @@
 package rabbitmq
 
+import (
+	"context"
+	"log/slog"
+)
+
 // Publisher wraps a Channel and provides a high-level API for publishing messages.
 type Publisher struct {
-	ch Channel
+	ch           Channel
+	interceptors []PublishInterceptor
+	logger       *slog.Logger
+}
+
+// PublishRequest is a message on its way to the broker. Interceptors may modify it.
+type PublishRequest struct {
+	Exchange   string
+	RoutingKey string
+	Mandatory  bool
+	Immediate  bool
+	Publishing Publishing
+}
+
+// PublishFunc sends a PublishRequest.
+type PublishFunc func(ctx context.Context, req *PublishRequest) error
+
+// PublishInterceptor wraps every publish made by a Publisher, for example to
+// add headers, validate payloads, record metrics or retry. See the middleware
+// package for built-in ones.
+type PublishInterceptor func(next PublishFunc) PublishFunc
+
+// PublisherOption configures a Publisher.
+type PublisherOption func(*Publisher)
+
+// WithInterceptors adds interceptors to the Publisher, the first one being the outermost.
+func WithInterceptors(interceptors ...PublishInterceptor) PublisherOption {
+	return func(p *Publisher) {
+		p.interceptors = append(p.interceptors, interceptors...)
+	}
+}
+
+// WithLogger sets the logger the Publisher reports failed publishes to at
+// error level and successful ones at debug level. Defaults to slog.Default().
+func WithLogger(logger *slog.Logger) PublisherOption {
+	return func(p *Publisher) {
+		if logger != nil {
+			p.logger = logger
+		}
+	}
 }
 
 // NewPublisher creates a new Publisher from an existing Channel.
-func NewPublisher(ch Channel) *Publisher {
-	return &Publisher{ch: ch}
+func NewPublisher(ch Channel, opts ...PublisherOption) *Publisher {
+	p := &Publisher{ch: ch, logger: slog.Default()}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
 }
 
 // Publish sends a message to the given exchange with the given routing key.
 func (p *Publisher) Publish(exchange, routingKey string, body []byte) error {
-	return p.ch.Publish(exchange, routingKey, body)
+	if len(p.interceptors) == 0 {
+		return p.logged(context.Background(), exchange, routingKey, p.ch.Publish(exchange, routingKey, body))
+	}
+	return p.PublishWithOptions(exchange, routingKey, false, false, Publishing{
+		ContentType: "application/octet-stream",
+		Body:        body,
+	})
+}
+
+// PublishWithOptions sends a message with explicit properties and publish flags.
+func (p *Publisher) PublishWithOptions(exchange, routingKey string, mandatory, immediate bool, msg Publishing) error {
+	if len(p.interceptors) == 0 {
+		return p.logged(context.Background(), exchange, routingKey, p.ch.PublishWithOptions(exchange, routingKey, mandatory, immediate, msg))
+	}
+	return p.logged(context.Background(), exchange, routingKey, p.intercept(context.Background(), exchange, routingKey, mandatory, immediate, msg,
+		func(_ context.Context, req *PublishRequest) error {
+			return p.ch.PublishWithOptions(req.Exchange, req.RoutingKey, req.Mandatory, req.Immediate, req.Publishing)
+		}))
+}
+
+// PublishWithContext sends a message, giving up when ctx is done before the publish is made.
+func (p *Publisher) PublishWithContext(ctx context.Context, exchange, routingKey string, mandatory, immediate bool, msg Publishing) error {
+	if len(p.interceptors) == 0 {
+		return p.logged(ctx, exchange, routingKey, p.ch.PublishWithContext(ctx, exchange, routingKey, mandatory, immediate, msg))
+	}
+	return p.logged(ctx, exchange, routingKey, p.intercept(ctx, exchange, routingKey, mandatory, immediate, msg,
+		func(ctx context.Context, req *PublishRequest) error {
+			return p.ch.PublishWithContext(ctx, req.Exchange, req.RoutingKey, req.Mandatory, req.Immediate, req.Publishing)
+		}))
+}
+
+// logged logs the outcome of a publish and returns err.
+func (p *Publisher) logged(ctx context.Context, exchange, routingKey string, err error) error {
+	attrs := []slog.Attr{slog.String("exchange", exchange), slog.String("routing_key", routingKey)}
+	if err != nil {
+		p.logger.LogAttrs(ctx, slog.LevelError, "publish failed", append(attrs, slog.Any("error", err))...)
+	} else {
+		p.logger.LogAttrs(ctx, slog.LevelDebug, "message published", attrs...)
+	}
+	return err
+}
+
+// intercept runs the publish through the interceptors, ending with send.
+func (p *Publisher) intercept(ctx context.Context, exchange, routingKey string, mandatory, immediate bool, msg Publishing, send PublishFunc) error {
+	for i := len(p.interceptors) - 1; i >= 0; i-- {
+		send = p.interceptors[i](send)
+	}
+	return send(ctx, &PublishRequest{
+		Exchange:   exchange,
+		RoutingKey: routingKey,
+		Mandatory:  mandatory,
+		Immediate:  immediate,
+		Publishing: msg,
+	})
+}
+
+// NotifyReturn registers c to receive messages the broker returns for
+// mandatory or immediate publishes. c is closed when the channel closes.
+func (p *Publisher) NotifyReturn(c chan Return) chan Return {
+	return p.ch.NotifyReturn(c)
 }
 
 // Close closes the underlying channel.
@@ -1,7 +1,10 @@
 package rabbitmq
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"log/slog"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -42,3 +45,109 @@ func TestPublisher_Close_Error(t *testing.T) {
 	require.Error(t, err)
 	require.True(t, mock.closed)
 }
+
+func TestPublisher_PublishWithOptions(t *testing.T) {
+	mock := &mockChannel{}
+	pub := NewPublisher(mock)
+
+	msg := Publishing{
+		Headers:      Table{"tenant": "acme"},
+		ContentType:  "application/json",
+		DeliveryMode: Persistent,
+		MessageID:    "msg-1",
+		Body:         []byte(`{"id":1}`),
+	}
+
+	err := pub.PublishWithOptions("exchange", "key", true, false, msg)
+	require.NoError(t, err)
+	require.Equal(t, mockPublish{
+		exchange:   "exchange",
+		routingKey: "key",
+		mandatory:  true,
+		msg:        msg,
+	}, mock.lastPublish)
+}
+
+func TestPublisher_NotifyReturn(t *testing.T) {
+	mock := &mockChannel{returnFunc: func(exchange, routingKey string) bool { return true }}
+	pub := NewPublisher(mock)
+
+	returns := pub.NotifyReturn(make(chan Return, 1))
+
+	err := pub.PublishWithOptions("exchange", "unbound", true, false, Publishing{
+		Headers: Table{"tenant": "acme"},
+		Body:    []byte("test"),
+	})
+	require.NoError(t, err)
+
+	r := <-returns
+	require.Equal(t, ReplyNoRoute, r.ReplyCode)
+	require.Equal(t, "exchange", r.Exchange)
+	require.Equal(t, "unbound", r.RoutingKey)
+	require.Equal(t, Table{"tenant": "acme"}, r.Headers)
+	require.Equal(t, []byte("test"), r.Body)
+
+	require.NoError(t, pub.Close())
+	_, open := <-returns
+	require.False(t, open)
+}
+
+func TestPublisher_Interceptors(t *testing.T) {
+	var calls []string
+	trace := func(name string) PublishInterceptor {
+		return func(next PublishFunc) PublishFunc {
+			return func(ctx context.Context, req *PublishRequest) error {
+				calls = append(calls, name)
+				req.Publishing.Headers = withHeader(req.Publishing.Headers, name, true)
+				return next(ctx, req)
+			}
+		}
+	}
+
+	mock := &mockChannel{}
+	pub := NewPublisher(mock, WithInterceptors(trace("outer"), trace("inner")))
+
+	require.NoError(t, pub.Publish("exchange", "key", []byte("test")))
+	require.Equal(t, []string{"outer", "inner"}, calls)
+	require.Equal(t, "application/octet-stream", mock.lastPublish.msg.ContentType)
+	require.Equal(t, Table{"outer": true, "inner": true}, mock.lastPublish.msg.Headers)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, pub.PublishWithContext(ctx, "exchange", "key", false, false, Publishing{}), context.Canceled)
+}
+
+func TestPublisher_InterceptorShortCircuits(t *testing.T) {
+	rejected := errors.New("rejected")
+	mock := &mockChannel{}
+	pub := NewPublisher(mock, WithInterceptors(func(next PublishFunc) PublishFunc {
+		return func(ctx context.Context, req *PublishRequest) error { return rejected }
+	}))
+
+	require.ErrorIs(t, pub.Publish("exchange", "key", []byte("test")), rejected)
+	require.False(t, mock.published)
+}
+
+func TestPublisher_Logger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	pub := NewPublisher(&mockChannel{}, WithLogger(logger))
+	require.NoError(t, pub.Publish("events", "order.created", []byte("x")))
+	require.Contains(t, buf.String(), `level=DEBUG msg="message published" exchange=events routing_key=order.created`)
+
+	buf.Reset()
+	pub = NewPublisher(&mockChannel{publishErr: errors.New("channel closed")}, WithLogger(logger))
+	require.Error(t, pub.PublishWithContext(context.Background(), "events", "order.paid", false, false, Publishing{}))
+	require.Contains(t, buf.String(), `level=ERROR msg="publish failed" exchange=events routing_key=order.paid error="channel closed"`)
+}
+
+func TestPublisher_DefaultLogger(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	pub := NewPublisher(&mockChannel{publishErr: errors.New("channel closed")})
+	require.Error(t, pub.Publish("events", "order.paid", nil))
+	require.Contains(t, buf.String(), `msg="publish failed" exchange=events routing_key=order.paid`)
+}
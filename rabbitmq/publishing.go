@@ -0,0 +1,30 @@
+package rabbitmq
+
+import "time"
+
+// Delivery modes for Publishing.DeliveryMode.
+const (
+	Transient  uint8 = 1
+	Persistent uint8 = 2
+)
+
+// Publishing holds the properties and body of a message to publish.
+type Publishing struct {
+	Headers Table // application or headers exchange table
+
+	// Properties
+	ContentType     string    // MIME content type
+	ContentEncoding string    // MIME content encoding
+	DeliveryMode    uint8     // Transient (0 or 1) or Persistent (2)
+	Priority        uint8     // 0 to 9
+	CorrelationID   string    // correlation identifier
+	ReplyTo         string    // address to reply to (ex: RPC)
+	Expiration      string    // message expiration spec in milliseconds
+	MessageID       string    // message identifier
+	Timestamp       time.Time // message timestamp
+	Type            string    // message type name
+	UserID          string    // creating user, must match the authenticated user
+	AppID           string    // creating application
+
+	Body []byte
+}
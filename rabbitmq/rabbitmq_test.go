@@ -2,7 +2,9 @@ package rabbitmq
 
 import (
 	"testing"
+	"time"
 
+	"github.com/streadway/amqp"
 	"github.com/stretchr/testify/require"
 )
 
@@ -19,6 +21,28 @@ func TestDeliveryConversion(t *testing.T) {
 	require.Equal(t, routingKey, delivery.RoutingKey)
 }
 
+func TestDelivery_Settle(t *testing.T) {
+	mock := &mockChannel{}
+	d := Delivery{Acknowledger: mock, DeliveryTag: 7}
+
+	require.NoError(t, d.Ack())
+	require.NoError(t, d.Nack(true))
+	require.NoError(t, d.Reject(false))
+
+	require.Equal(t, []uint64{7}, mock.acked)
+	require.Equal(t, []uint64{7}, mock.nacked)
+	require.Equal(t, []uint64{7}, mock.rejected)
+	require.Equal(t, []uint64{7}, mock.requeued)
+}
+
+func TestDelivery_SettleWithoutAcknowledger(t *testing.T) {
+	d := Delivery{Body: []byte("orphan")}
+
+	require.ErrorIs(t, d.Ack(), ErrDeliveryNotInitialized)
+	require.ErrorIs(t, d.Nack(true), ErrDeliveryNotInitialized)
+	require.ErrorIs(t, d.Reject(false), ErrDeliveryNotInitialized)
+}
+
 func TestTableConversion(t *testing.T) {
 	rawTable := Table{
 		"x-message-ttl": int32(60000),
@@ -28,3 +52,102 @@ func TestTableConversion(t *testing.T) {
 
 	require.Equal(t, int32(60000), converted["x-message-ttl"])
 }
+
+func TestDeliveryFromAMQP(t *testing.T) {
+	ts := time.Date(2025, 4, 26, 16, 52, 39, 0, time.UTC)
+	raw := amqp.Delivery{
+		Headers: amqp.Table{
+			"x-death": []interface{}{amqp.Table{"count": int64(1), "queue": "orders"}},
+			"tenant":  "acme",
+		},
+		ContentType:     "application/json",
+		ContentEncoding: "gzip",
+		DeliveryMode:    amqp.Persistent,
+		Priority:        5,
+		CorrelationId:   "corr-1",
+		ReplyTo:         "replies",
+		Expiration:      "60000",
+		MessageId:       "msg-1",
+		Timestamp:       ts,
+		Type:            "order.created",
+		UserId:          "guest",
+		AppId:           "billing",
+		ConsumerTag:     "worker-1",
+		DeliveryTag:     42,
+		Redelivered:     true,
+		Exchange:        "orders",
+		RoutingKey:      "order.created",
+		Body:            []byte("{}"),
+	}
+
+	d := deliveryFromAMQP(raw)
+
+	require.Equal(t, "acme", d.Headers["tenant"])
+	require.Equal(t, []interface{}{Table{"count": int64(1), "queue": "orders"}}, d.Headers["x-death"])
+	require.Equal(t, "application/json", d.ContentType)
+	require.Equal(t, "gzip", d.ContentEncoding)
+	require.Equal(t, uint8(2), d.DeliveryMode)
+	require.Equal(t, uint8(5), d.Priority)
+	require.Equal(t, "corr-1", d.CorrelationID)
+	require.Equal(t, "replies", d.ReplyTo)
+	require.Equal(t, "60000", d.Expiration)
+	require.Equal(t, "msg-1", d.MessageID)
+	require.Equal(t, ts, d.Timestamp)
+	require.Equal(t, "order.created", d.Type)
+	require.Equal(t, "guest", d.UserID)
+	require.Equal(t, "billing", d.AppID)
+	require.Equal(t, "worker-1", d.ConsumerTag)
+	require.Equal(t, uint64(42), d.DeliveryTag)
+	require.True(t, d.Redelivered)
+	require.Equal(t, "orders", d.Exchange)
+	require.Equal(t, "order.created", d.RoutingKey)
+	require.Equal(t, []byte("{}"), d.Body)
+}
+
+func TestNestedTableConversion(t *testing.T) {
+	converted := tableToAMQP(Table{
+		"nested": Table{"key": "value"},
+		"list":   []interface{}{Table{"inner": int32(1)}},
+	})
+
+	require.Equal(t, amqp.Table{"key": "value"}, converted["nested"])
+	require.Equal(t, []interface{}{amqp.Table{"inner": int32(1)}}, converted["list"])
+	require.NoError(t, converted.Validate())
+}
+
+func TestPublishingToAMQP(t *testing.T) {
+	ts := time.Date(2025, 4, 26, 16, 52, 39, 0, time.UTC)
+	msg := Publishing{
+		Headers:         Table{"trace": Table{"id": "abc"}},
+		ContentType:     "application/json",
+		ContentEncoding: "gzip",
+		DeliveryMode:    Persistent,
+		Priority:        3,
+		CorrelationID:   "corr-1",
+		ReplyTo:         "replies",
+		Expiration:      "60000",
+		MessageID:       "msg-1",
+		Timestamp:       ts,
+		Type:            "order.created",
+		UserID:          "guest",
+		AppID:           "billing",
+		Body:            []byte("{}"),
+	}
+
+	raw := publishingToAMQP(msg)
+
+	require.Equal(t, amqp.Table{"trace": amqp.Table{"id": "abc"}}, raw.Headers)
+	require.Equal(t, "application/json", raw.ContentType)
+	require.Equal(t, "gzip", raw.ContentEncoding)
+	require.Equal(t, amqp.Persistent, raw.DeliveryMode)
+	require.Equal(t, uint8(3), raw.Priority)
+	require.Equal(t, "corr-1", raw.CorrelationId)
+	require.Equal(t, "replies", raw.ReplyTo)
+	require.Equal(t, "60000", raw.Expiration)
+	require.Equal(t, "msg-1", raw.MessageId)
+	require.Equal(t, ts, raw.Timestamp)
+	require.Equal(t, "order.created", raw.Type)
+	require.Equal(t, "guest", raw.UserId)
+	require.Equal(t, "billing", raw.AppId)
+	require.Equal(t, []byte("{}"), raw.Body)
+}
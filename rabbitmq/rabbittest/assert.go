@@ -0,0 +1,178 @@
+// Package rabbittest provides testify-style assertions over messages captured
+// by mocks.MockChannel and a Harness that runs a Worker against a mock.
+//
+// Assertions report failures through t and return whether they passed, like
+// the functions of testify's assert package.
+package rabbittest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/eugene-ruby/xconnect/rabbitmq/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestingT is the subset of *testing.T the assertions need.
+type TestingT = assert.TestingT
+
+// Route is the exchange and routing key a message was published with.
+type Route struct {
+	Exchange   string
+	RoutingKey string
+}
+
+func (r Route) String() string {
+	return fmt.Sprintf("exchange %q, routing key %q", r.Exchange, r.RoutingKey)
+}
+
+// Published returns the messages mock published to exchange with routingKey.
+func Published(mock *mocks.MockChannel, exchange, routingKey string) []mocks.PublishedMessage {
+	var out []mocks.PublishedMessage
+	for _, msg := range mock.Published() {
+		if msg.Exchange == exchange && msg.RoutingKey == routingKey {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
+
+// AssertPublished asserts that mock published at least one message to
+// exchange with routingKey.
+func AssertPublished(t TestingT, mock *mocks.MockChannel, exchange, routingKey string, msgAndArgs ...interface{}) bool {
+	helper(t)
+	if len(Published(mock, exchange, routingKey)) > 0 {
+		return true
+	}
+	return assert.Fail(t, fmt.Sprintf("No message published to %s.\nPublished to: %v", Route{exchange, routingKey}, routes(mock)), msgAndArgs...)
+}
+
+// AssertNotPublished asserts that mock published nothing to exchange with routingKey.
+func AssertNotPublished(t TestingT, mock *mocks.MockChannel, exchange, routingKey string, msgAndArgs ...interface{}) bool {
+	helper(t)
+	if n := len(Published(mock, exchange, routingKey)); n > 0 {
+		return assert.Fail(t, fmt.Sprintf("%d message(s) published to %s", n, Route{exchange, routingKey}), msgAndArgs...)
+	}
+	return true
+}
+
+// AssertPublishedCount asserts that mock published exactly n messages.
+func AssertPublishedCount(t TestingT, mock *mocks.MockChannel, n int, msgAndArgs ...interface{}) bool {
+	helper(t)
+	if got := len(mock.Published()); got != n {
+		return assert.Fail(t, fmt.Sprintf("Expected %d published message(s), got %d: %v", n, got, routes(mock)), msgAndArgs...)
+	}
+	return true
+}
+
+// AssertPublishedRoutes asserts that mock published exactly one message per
+// route, in the given order.
+func AssertPublishedRoutes(t TestingT, mock *mocks.MockChannel, expected []Route, msgAndArgs ...interface{}) bool {
+	helper(t)
+	actual := routes(mock)
+	if len(expected) == 0 && len(actual) == 0 {
+		return true
+	}
+	return assert.Equal(t, expected, actual, msgAndArgs...)
+}
+
+// AssertJSONBody asserts that msg has a JSON body equal to expected, which
+// is either a JSON string or []byte, or a value to marshal.
+func AssertJSONBody(t TestingT, msg mocks.PublishedMessage, expected interface{}, msgAndArgs ...interface{}) bool {
+	helper(t)
+	want, err := jsonOf(expected)
+	if err != nil {
+		return assert.Fail(t, fmt.Sprintf("Cannot marshal expected body: %v", err), msgAndArgs...)
+	}
+	return assert.JSONEq(t, string(want), string(msg.Body), msgAndArgs...)
+}
+
+// AssertJSONBodyContains asserts that msg has a JSON body containing subset:
+// every field of a subset object must be present with an equal value, nested
+// objects being compared the same way. subset is a JSON string or []byte, or
+// a value to marshal.
+func AssertJSONBodyContains(t TestingT, msg mocks.PublishedMessage, subset interface{}, msgAndArgs ...interface{}) bool {
+	helper(t)
+	want, err := jsonOf(subset)
+	if err != nil {
+		return assert.Fail(t, fmt.Sprintf("Cannot marshal expected subset: %v", err), msgAndArgs...)
+	}
+	var expected, actual interface{}
+	if err := json.Unmarshal(want, &expected); err != nil {
+		return assert.Fail(t, fmt.Sprintf("Expected subset is not valid JSON: %v", err), msgAndArgs...)
+	}
+	if err := json.Unmarshal(msg.Body, &actual); err != nil {
+		return assert.Fail(t, fmt.Sprintf("Body is not valid JSON: %v\nBody: %s", err, msg.Body), msgAndArgs...)
+	}
+	if !jsonContains(actual, expected) {
+		return assert.Fail(t, fmt.Sprintf("Body does not contain %s\nBody: %s", want, msg.Body), msgAndArgs...)
+	}
+	return true
+}
+
+// AssertHeader asserts that msg carries header key with value.
+func AssertHeader(t TestingT, msg mocks.PublishedMessage, key string, value interface{}, msgAndArgs ...interface{}) bool {
+	helper(t)
+	got, ok := msg.Publishing.Headers[key]
+	if !ok {
+		return assert.Fail(t, fmt.Sprintf("Header %q not set.\nHeaders: %v", key, msg.Publishing.Headers), msgAndArgs...)
+	}
+	if !assert.ObjectsAreEqual(value, got) {
+		return assert.Fail(t, fmt.Sprintf("Header %q is %#v, expected %#v", key, got, value), msgAndArgs...)
+	}
+	return true
+}
+
+// AssertHasHeader asserts that msg carries header key, whatever its value.
+func AssertHasHeader(t TestingT, msg mocks.PublishedMessage, key string, msgAndArgs ...interface{}) bool {
+	helper(t)
+	if _, ok := msg.Publishing.Headers[key]; !ok {
+		return assert.Fail(t, fmt.Sprintf("Header %q not set.\nHeaders: %v", key, msg.Publishing.Headers), msgAndArgs...)
+	}
+	return true
+}
+
+func routes(mock *mocks.MockChannel) []Route {
+	published := mock.Published()
+	out := make([]Route, len(published))
+	for i, msg := range published {
+		out[i] = Route{Exchange: msg.Exchange, RoutingKey: msg.RoutingKey}
+	}
+	return out
+}
+
+func jsonOf(v interface{}) ([]byte, error) {
+	switch s := v.(type) {
+	case string:
+		return []byte(s), nil
+	case []byte:
+		return s, nil
+	default:
+		return json.Marshal(v)
+	}
+}
+
+// jsonContains reports whether decoded JSON actual contains expected.
+func jsonContains(actual, expected interface{}) bool {
+	want, ok := expected.(map[string]interface{})
+	if !ok {
+		return reflect.DeepEqual(actual, expected)
+	}
+	got, ok := actual.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for k, v := range want {
+		if av, ok := got[k]; !ok || !jsonContains(av, v) {
+			return false
+		}
+	}
+	return true
+}
+
+func helper(t TestingT) {
+	if h, ok := t.(interface{ Helper() }); ok {
+		h.Helper()
+	}
+}
@@ -0,0 +1,203 @@
+package rabbittest
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eugene-ruby/xconnect/rabbitmq"
+	"github.com/eugene-ruby/xconnect/rabbitmq/mocks"
+)
+
+// DefaultTimeout bounds the Harness wait helpers unless Harness.Timeout is set.
+const DefaultTimeout = time.Second
+
+// Outcome is how a delivery was settled.
+type Outcome int
+
+const (
+	Unsettled Outcome = iota
+	Acked
+	Requeued // nacked or rejected with requeue
+	Nacked   // nacked without requeue
+	Rejected // rejected without requeue
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case Acked:
+		return "acked"
+	case Requeued:
+		return "requeued"
+	case Nacked:
+		return "nacked"
+	case Rejected:
+		return "rejected"
+	default:
+		return "unsettled"
+	}
+}
+
+// Handled is a delivery the worker's handler returned from.
+type Handled struct {
+	Delivery rabbitmq.Delivery
+	Err      error
+}
+
+// Harness runs a Worker against a MockChannel, feeds it deliveries and
+// waits for them to be handled and settled.
+type Harness struct {
+	Mock    *mocks.MockChannel
+	Worker  *rabbitmq.Worker
+	Timeout time.Duration // bounds the wait helpers, DefaultTimeout when zero
+
+	t       testing.TB
+	tag     atomic.Uint64
+	mu      sync.Mutex
+	handled []Handled
+}
+
+// StartWorker starts a Worker with config on a new MockChannel. The worker
+// is shut down when the test finishes.
+func StartWorker(t testing.TB, config rabbitmq.WorkerConfig) *Harness {
+	t.Helper()
+	h := &Harness{Mock: mocks.NewMockChannel(), t: t}
+	config.Middleware = append([]rabbitmq.Middleware{h.record}, config.Middleware...)
+	if config.ShutdownTimeout == 0 {
+		config.ShutdownTimeout = DefaultTimeout
+	}
+	h.Worker = rabbitmq.NewWorker(h.Mock, config)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := h.Worker.Start(ctx); err != nil {
+		cancel()
+		t.Fatalf("rabbittest: start worker: %v", err)
+	}
+	t.Cleanup(func() {
+		cancel()
+		h.Worker.Wait()
+	})
+	return h
+}
+
+// record is the outermost middleware; it captures every handler result.
+func (h *Harness) record(next rabbitmq.ContextHandlerFunc) rabbitmq.ContextHandlerFunc {
+	return func(ctx context.Context, d rabbitmq.Delivery) error {
+		err := next(ctx, d)
+		h.mu.Lock()
+		h.handled = append(h.handled, Handled{Delivery: d, Err: err})
+		h.mu.Unlock()
+		return err
+	}
+}
+
+// Deliver feeds d to the worker with a fresh delivery tag, which it returns.
+func (h *Harness) Deliver(d rabbitmq.Delivery) uint64 {
+	d.DeliveryTag = h.tag.Add(1)
+	h.Mock.ConsumeMessages <- d
+	return d.DeliveryTag
+}
+
+// DeliverJSON feeds the JSON encoding of v to the worker and returns its delivery tag.
+func (h *Harness) DeliverJSON(v interface{}) uint64 {
+	h.t.Helper()
+	body, err := json.Marshal(v)
+	if err != nil {
+		h.t.Fatalf("rabbittest: marshal delivery: %v", err)
+	}
+	return h.Deliver(rabbitmq.Delivery{ContentType: rabbitmq.JSONContentType, Body: body})
+}
+
+// Handled returns the handler results so far, in completion order.
+func (h *Harness) Handled() []Handled {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Handled(nil), h.handled...)
+}
+
+// WaitHandled waits until the handler returned for n deliveries and returns
+// their results. The test fails if that takes longer than the timeout.
+func (h *Harness) WaitHandled(n int) []Handled {
+	h.t.Helper()
+	var handled []Handled
+	if !h.eventually(func() bool {
+		handled = h.Handled()
+		return len(handled) >= n
+	}) {
+		h.t.Fatalf("rabbittest: %d of %d deliveries handled after %s", len(handled), n, h.timeout())
+	}
+	return handled
+}
+
+// Outcome reports how the delivery with tag was settled so far.
+func (h *Harness) Outcome(tag uint64) Outcome {
+	covers := func(s mocks.Settlement) bool {
+		return s.DeliveryTag == tag || (s.Multiple && s.DeliveryTag > tag)
+	}
+	for _, s := range h.Mock.Acked() {
+		if covers(s) {
+			return Acked
+		}
+	}
+	for _, s := range h.Mock.Nacked() {
+		if covers(s) {
+			if s.Requeue {
+				return Requeued
+			}
+			return Nacked
+		}
+	}
+	for _, s := range h.Mock.Rejected() {
+		if covers(s) {
+			if s.Requeue {
+				return Requeued
+			}
+			return Rejected
+		}
+	}
+	return Unsettled
+}
+
+// WaitSettled waits until the delivery with tag is settled and returns the
+// outcome, or Unsettled once the timeout passes.
+func (h *Harness) WaitSettled(tag uint64) Outcome {
+	var outcome Outcome
+	h.eventually(func() bool {
+		outcome = h.Outcome(tag)
+		return outcome != Unsettled
+	})
+	return outcome
+}
+
+// AssertSettled asserts that the delivery with tag is settled with want
+// within the timeout.
+func (h *Harness) AssertSettled(tag uint64, want Outcome) bool {
+	h.t.Helper()
+	if got := h.WaitSettled(tag); got != want {
+		h.t.Errorf("rabbittest: delivery %d %s, expected %s", tag, got, want)
+		return false
+	}
+	return true
+}
+
+func (h *Harness) timeout() time.Duration {
+	if h.Timeout > 0 {
+		return h.Timeout
+	}
+	return DefaultTimeout
+}
+
+// eventually polls cond until it holds or the timeout passes.
+func (h *Harness) eventually(cond func() bool) bool {
+	deadline := time.Now().Add(h.timeout())
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return true
+}
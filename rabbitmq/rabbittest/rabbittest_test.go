@@ -0,0 +1,100 @@
+package rabbittest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/eugene-ruby/xconnect/rabbitmq"
+	"github.com/eugene-ruby/xconnect/rabbitmq/mocks"
+	"github.com/eugene-ruby/xconnect/rabbitmq/rabbittest"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder collects assertion failures instead of failing the test.
+type recorder struct{ failures []string }
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func publishOrders(t *testing.T) *mocks.MockChannel {
+	mock := mocks.NewMockChannel()
+	pub := rabbitmq.NewTypedPublisher[map[string]interface{}](rabbitmq.NewPublisher(mock), rabbitmq.JSON)
+	ctx := context.Background()
+	require.NoError(t, pub.PublishWithOptions(ctx, "orders", "order.created",
+		map[string]interface{}{"id": 42, "customer": map[string]interface{}{"id": 7, "name": "Ann"}},
+		rabbitmq.Publishing{Headers: rabbitmq.Table{"tenant": "acme"}}))
+	require.NoError(t, pub.Publish(ctx, "audit", "", map[string]interface{}{"event": "order.created"}))
+	return mock
+}
+
+func TestAssertions(t *testing.T) {
+	mock := publishOrders(t)
+
+	require.True(t, rabbittest.AssertPublished(t, mock, "orders", "order.created"))
+	require.True(t, rabbittest.AssertNotPublished(t, mock, "orders", "order.paid"))
+	require.True(t, rabbittest.AssertPublishedCount(t, mock, 2))
+	require.True(t, rabbittest.AssertPublishedRoutes(t, mock, []rabbittest.Route{
+		{Exchange: "orders", RoutingKey: "order.created"},
+		{Exchange: "audit"},
+	}))
+
+	msg := rabbittest.Published(mock, "orders", "order.created")[0]
+	require.True(t, rabbittest.AssertJSONBody(t, msg, `{"customer":{"name":"Ann","id":7},"id":42}`))
+	require.True(t, rabbittest.AssertJSONBodyContains(t, msg, map[string]interface{}{"customer": map[string]interface{}{"id": 7}}))
+	require.True(t, rabbittest.AssertHeader(t, msg, "tenant", "acme"))
+	require.True(t, rabbittest.AssertHasHeader(t, msg, "tenant"))
+}
+
+func TestAssertionFailures(t *testing.T) {
+	mock := publishOrders(t)
+	msg := rabbittest.Published(mock, "orders", "order.created")[0]
+
+	r := &recorder{}
+	require.False(t, rabbittest.AssertPublished(r, mock, "orders", "order.paid"))
+	require.False(t, rabbittest.AssertNotPublished(r, mock, "audit", ""))
+	require.False(t, rabbittest.AssertPublishedCount(r, mock, 3))
+	require.False(t, rabbittest.AssertJSONBody(r, msg, map[string]int{"id": 42}))
+	require.False(t, rabbittest.AssertJSONBodyContains(r, msg, `{"customer":{"name":"Bob"}}`))
+	require.False(t, rabbittest.AssertHeader(r, msg, "tenant", "other"))
+	require.False(t, rabbittest.AssertHasHeader(r, msg, "trace-id"))
+
+	require.Len(t, r.failures, 7)
+	require.Contains(t, r.failures[0], `No message published to exchange "orders", routing key "order.paid"`)
+	require.Contains(t, r.failures[5], `Header "tenant" is "acme", expected "other"`)
+}
+
+func TestHarness(t *testing.T) {
+	errBusy := errors.New("busy")
+	h := rabbittest.StartWorker(t, rabbitmq.WorkerConfig{
+		Queue: "orders",
+		Handler: func(d rabbitmq.Delivery) error {
+			switch string(d.Body) {
+			case `"busy"`:
+				return rabbitmq.Requeue(errBusy)
+			case `"invalid"`:
+				return rabbitmq.Permanent(errors.New("invalid"))
+			case `"failed"`:
+				return errors.New("failed")
+			}
+			return nil
+		},
+	})
+
+	ok := h.DeliverJSON("ok")
+	busy := h.DeliverJSON("busy")
+	invalid := h.DeliverJSON("invalid")
+	failed := h.DeliverJSON("failed")
+
+	handled := h.WaitHandled(4)
+	require.Len(t, handled, 4)
+	require.ErrorIs(t, handled[1].Err, errBusy)
+
+	require.True(t, h.AssertSettled(ok, rabbittest.Acked))
+	require.True(t, h.AssertSettled(busy, rabbittest.Requeued))
+	require.True(t, h.AssertSettled(invalid, rabbittest.Rejected))
+	require.True(t, h.AssertSettled(failed, rabbittest.Nacked))
+	require.Equal(t, rabbittest.Unsettled, h.Outcome(99))
+}
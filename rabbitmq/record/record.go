@@ -0,0 +1,171 @@
+// Package record captures message traffic of a rabbitmq.Channel to a file
+// and replays it into a handler or back onto a channel, for reproducing
+// production behaviour locally.
+package record
+
+import (
+	"bufio"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/eugene-ruby/xconnect/internal/table"
+	"github.com/eugene-ruby/xconnect/rabbitmq"
+)
+
+// Direction tells whether an entry was published or consumed.
+type Direction string
+
+const (
+	Published Direction = "publish"
+	Consumed  Direction = "consume"
+)
+
+// Format selects the encoding of a capture.
+type Format int
+
+const (
+	// JSONLines writes one JSON object per line. Header numbers are read
+	// back as int64 when integral and float64 otherwise, nested objects as
+	// Tables.
+	JSONLines Format = iota
+	// Binary writes a gob stream that keeps header value types.
+	Binary
+)
+
+func init() {
+	gob.Register(rabbitmq.Table{})
+	gob.Register([]interface{}{})
+	gob.Register(time.Time{})
+}
+
+// Entry is a captured message.
+type Entry struct {
+	Time        time.Time           `json:"time"`
+	Direction   Direction           `json:"direction"`
+	Exchange    string              `json:"exchange"`
+	RoutingKey  string              `json:"routingKey"`
+	Queue       string              `json:"queue,omitempty"` // queue a consumed message came from
+	Mandatory   bool                `json:"mandatory,omitempty"`
+	Redelivered bool                `json:"redelivered,omitempty"`
+	Message     rabbitmq.Publishing `json:"message"`
+}
+
+// Delivery returns the entry as a Delivery without an Acknowledger.
+func (e Entry) Delivery() rabbitmq.Delivery {
+	m := e.Message
+	return rabbitmq.Delivery{
+		Headers:         m.Headers,
+		ContentType:     m.ContentType,
+		ContentEncoding: m.ContentEncoding,
+		DeliveryMode:    m.DeliveryMode,
+		Priority:        m.Priority,
+		CorrelationID:   m.CorrelationID,
+		ReplyTo:         m.ReplyTo,
+		Expiration:      m.Expiration,
+		MessageID:       m.MessageID,
+		Timestamp:       m.Timestamp,
+		Type:            m.Type,
+		UserID:          m.UserID,
+		AppID:           m.AppID,
+		Redelivered:     e.Redelivered,
+		Exchange:        e.Exchange,
+		RoutingKey:      e.RoutingKey,
+		Body:            m.Body,
+	}
+}
+
+// Writer appends entries to a capture.
+type Writer interface {
+	Write(e Entry) error
+}
+
+// Reader reads entries from a capture, returning io.EOF at its end.
+type Reader interface {
+	Read() (Entry, error)
+}
+
+// NewWriter returns a Writer encoding entries to w in format f.
+func NewWriter(w io.Writer, f Format) Writer {
+	if f == Binary {
+		return gobWriter{gob.NewEncoder(w)}
+	}
+	return jsonWriter{json.NewEncoder(w)}
+}
+
+// NewReader returns a Reader decoding entries from r in format f.
+func NewReader(r io.Reader, f Format) Reader {
+	if f == Binary {
+		return gobReader{gob.NewDecoder(r)}
+	}
+	dec := json.NewDecoder(bufio.NewReader(r))
+	dec.UseNumber()
+	return jsonReader{dec}
+}
+
+type jsonWriter struct{ enc *json.Encoder }
+
+func (w jsonWriter) Write(e Entry) error { return w.enc.Encode(e) }
+
+type jsonReader struct{ dec *json.Decoder }
+
+func (r jsonReader) Read() (Entry, error) {
+	var e Entry
+	err := r.dec.Decode(&e)
+	if err == nil {
+		e.Message.Headers = table.Normalize(e.Message.Headers)
+	}
+	return e, err
+}
+
+type gobWriter struct{ enc *gob.Encoder }
+
+func (w gobWriter) Write(e Entry) error { return w.enc.Encode(e) }
+
+type gobReader struct{ dec *gob.Decoder }
+
+func (r gobReader) Read() (Entry, error) {
+	var e Entry
+	err := r.dec.Decode(&e)
+	return e, err
+}
+
+// ReadAll reads every entry of r.
+func ReadAll(r Reader) ([]Entry, error) {
+	var entries []Entry
+	for {
+		e, err := r.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, fmt.Errorf("record: entry %d: %w", len(entries)+1, err)
+		}
+		entries = append(entries, e)
+	}
+}
+
+// FormatOf picks the format from a file extension: ".jsonl", ".ndjson" and
+// ".json" are JSONLines, anything else Binary.
+func FormatOf(path string) Format {
+	switch filepath.Ext(path) {
+	case ".jsonl", ".ndjson", ".json":
+		return JSONLines
+	default:
+		return Binary
+	}
+}
+
+// Load reads a capture file in the format given by its extension.
+func Load(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("record: %w", err)
+	}
+	defer f.Close()
+	return ReadAll(NewReader(f, FormatOf(path)))
+}
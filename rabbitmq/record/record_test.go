@@ -0,0 +1,201 @@
+package record_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/eugene-ruby/xconnect/rabbitmq"
+	"github.com/eugene-ruby/xconnect/rabbitmq/dlq"
+	"github.com/eugene-ruby/xconnect/rabbitmq/mocks"
+	"github.com/eugene-ruby/xconnect/rabbitmq/record"
+)
+
+func TestRecorder_JSONLines(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	mock.GetMessages = map[string][]rabbitmq.Delivery{
+		"jobs": {{Exchange: "work", RoutingKey: "job.run", Body: []byte("job")}},
+	}
+	var buf bytes.Buffer
+	rec := record.NewRecorder(mock, record.NewWriter(&buf, record.JSONLines))
+
+	require.NoError(t, rec.PublishWithOptions("events", "order.created", true, false, rabbitmq.Publishing{
+		ContentType: "application/json",
+		Headers:     rabbitmq.Table{"attempt": int64(2), "meta": rabbitmq.Table{"source": "api"}},
+		Body:        []byte(`{"id":1}`),
+	}))
+	require.NoError(t, rec.Publish("events", "order.paid", []byte("raw")))
+
+	deliveries, err := rec.Consume("orders", "c1", false, false, false, false, nil)
+	require.NoError(t, err)
+	mock.ConsumeMessages <- rabbitmq.Delivery{Exchange: "events", RoutingKey: "order.created", Redelivered: true, Body: []byte("in")}
+	d := <-deliveries
+	require.Equal(t, []byte("in"), d.Body)
+	require.NoError(t, d.Ack(), "deliveries keep the wrapped channel as Acknowledger")
+
+	_, ok, err := rec.Get("jobs", true)
+	require.NoError(t, err)
+	require.True(t, ok)
+	_, ok, err = rec.Get("jobs", true)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.NoError(t, rec.Err())
+
+	require.Equal(t, 4, bytes.Count(buf.Bytes(), []byte("\n")), "one line per entry")
+	entries, err := record.ReadAll(record.NewReader(&buf, record.JSONLines))
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+
+	require.Equal(t, record.Published, entries[0].Direction)
+	require.Equal(t, "order.created", entries[0].RoutingKey)
+	require.True(t, entries[0].Mandatory)
+	require.Equal(t, `{"id":1}`, string(entries[0].Message.Body))
+	require.Equal(t, int64(2), entries[0].Message.Headers["attempt"], "JSON reads integers back as int64")
+	require.Equal(t, rabbitmq.Table{"source": "api"}, entries[0].Message.Headers["meta"])
+	require.Equal(t, "application/octet-stream", entries[1].Message.ContentType)
+
+	require.Equal(t, record.Consumed, entries[2].Direction)
+	require.Equal(t, "orders", entries[2].Queue)
+	require.True(t, entries[2].Redelivered)
+	require.Equal(t, "jobs", entries[3].Queue)
+	require.Equal(t, "job.run", entries[3].RoutingKey)
+
+	require.False(t, entries[0].Time.IsZero())
+	require.False(t, entries[3].Time.Before(entries[0].Time))
+}
+
+func TestRecordFile_Binary(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	path := filepath.Join(t.TempDir(), "capture.bin")
+	rec, err := record.RecordFile(mock, path)
+	require.NoError(t, err)
+
+	stamp := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, rec.PublishWithContext(context.Background(), "events", "order.created", false, false, rabbitmq.Publishing{
+		Headers:   rabbitmq.Table{"attempt": int64(2), "tags": []interface{}{"a", int32(1)}},
+		Timestamp: stamp,
+		Body:      []byte{0, 1, 2},
+	}))
+	mock.PublishErr = errors.New("boom")
+	require.Error(t, rec.Publish("events", "order.failed", nil))
+	require.NoError(t, rec.Close())
+
+	entries, err := record.Load(path)
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "failed publishes are not recorded")
+	require.Equal(t, int64(2), entries[0].Message.Headers["attempt"], "binary keeps header types")
+	require.Equal(t, []interface{}{"a", int32(1)}, entries[0].Message.Headers["tags"])
+	require.True(t, stamp.Equal(entries[0].Message.Timestamp))
+	require.Equal(t, []byte{0, 1, 2}, entries[0].Message.Body)
+}
+
+func TestJSONLines_KeepsRetryHeaders(t *testing.T) {
+	var buf bytes.Buffer
+	w := record.NewWriter(&buf, record.JSONLines)
+	require.NoError(t, w.Write(record.Entry{Direction: record.Consumed, Message: rabbitmq.Publishing{
+		Headers: rabbitmq.Table{
+			rabbitmq.RetryCountHeader: int64(2),
+			"ratio":                   0.5,
+			"x-death": []interface{}{rabbitmq.Table{
+				"queue": "orders", "reason": "rejected", "count": int64(3),
+				"exchange": "shop", "routing-keys": []interface{}{"order.created"},
+			}},
+		},
+	}}))
+
+	entries, err := record.ReadAll(record.NewReader(&buf, record.JSONLines))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	d := rabbitmq.Delivery{Headers: entries[0].Message.Headers}
+	require.Equal(t, 2, rabbitmq.RetryCount(d))
+	require.Equal(t, 0.5, d.Headers["ratio"])
+	deaths := dlq.Deaths(d)
+	require.Len(t, deaths, 1)
+	require.Equal(t, int64(3), deaths[0].Count)
+	require.Equal(t, []string{"order.created"}, deaths[0].RoutingKeys)
+}
+
+func capture() []record.Entry {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	entry := func(offset time.Duration, dir record.Direction, exchange, key, body string) record.Entry {
+		return record.Entry{
+			Time:       start.Add(offset),
+			Direction:  dir,
+			Exchange:   exchange,
+			RoutingKey: key,
+			Message:    rabbitmq.Publishing{Body: []byte(body)},
+		}
+	}
+	return []record.Entry{
+		entry(0, record.Consumed, "events", "order.created", "1"),
+		entry(10*time.Millisecond, record.Published, "events", "order.shipped", "2"),
+		entry(20*time.Millisecond, record.Consumed, "audit", "order.created", "3"),
+		entry(200*time.Millisecond, record.Consumed, "events", "order.eu.paid", "4"),
+	}
+}
+
+func TestReplayToHandler(t *testing.T) {
+	var bodies []string
+	handler := func(ctx context.Context, d rabbitmq.Delivery) error {
+		fromCtx, ok := rabbitmq.DeliveryFromContext(ctx)
+		require.True(t, ok)
+		require.Equal(t, d.Body, fromCtx.Body)
+		bodies = append(bodies, string(d.Body))
+		if string(d.Body) == "4" {
+			return errors.New("bad order")
+		}
+		return nil
+	}
+
+	started := time.Now()
+	err := record.ReplayToHandler(context.Background(), capture(), handler, record.ReplayOptions{
+		Direction:  record.Consumed,
+		Exchange:   "events",
+		RoutingKey: "order.#",
+		Speed:      10,
+	})
+	require.Equal(t, []string{"1", "4"}, bodies)
+	require.GreaterOrEqual(t, time.Since(started), 20*time.Millisecond, "the 200ms gap is scaled by Speed")
+	require.ErrorContains(t, err, "bad order")
+	require.ErrorContains(t, err, "entry 2")
+}
+
+func TestReplayToHandler_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := record.ReplayToHandler(ctx, capture(), func(context.Context, rabbitmq.Delivery) error {
+		calls++
+		cancel()
+		return nil
+	}, record.ReplayOptions{Speed: 1})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 1, calls)
+}
+
+func TestReplayToChannel(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	entries := capture()
+	entries[0].Message.UserID = "billing"
+	err := record.ReplayToChannel(context.Background(), mock, entries, record.ReplayOptions{
+		Filter: func(e record.Entry) bool { return e.Exchange == "events" },
+	})
+	require.NoError(t, err)
+	require.Empty(t, mock.Published()[0].Publishing.UserID, "the broker rejects a user-id it did not authenticate")
+	require.Equal(t, "billing", entries[0].Message.UserID)
+
+	published := mock.Published()
+	require.Len(t, published, 3)
+	require.Equal(t, "order.created", published[0].RoutingKey)
+	require.Equal(t, "order.shipped", published[1].RoutingKey)
+	require.Equal(t, "4", string(published[2].Body))
+
+	mock.PublishErr = errors.New("closed")
+	err = record.ReplayToChannel(context.Background(), mock, capture(), record.ReplayOptions{RoutingKey: "order.*"})
+	require.ErrorContains(t, err, "entry 1 (events order.created)")
+	require.Len(t, mock.Published(), 3)
+}
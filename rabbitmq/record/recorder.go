@@ -0,0 +1,130 @@
+package record
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/eugene-ruby/xconnect/rabbitmq"
+)
+
+// Recorder is a rabbitmq.Channel that writes every message published
+// through it, and every message consumed or fetched from it, to a capture.
+// Other calls go straight to the wrapped channel.
+type Recorder struct {
+	rabbitmq.Channel
+
+	mu     sync.Mutex
+	w      Writer
+	closer func() error // closes the capture file, if the recorder opened it
+	err    error
+}
+
+// NewRecorder records the traffic of ch to w.
+func NewRecorder(ch rabbitmq.Channel, w Writer) *Recorder {
+	return &Recorder{Channel: ch, w: w}
+}
+
+// RecordFile creates the capture file path, in the format given by its
+// extension, and records the traffic of ch to it. Close closes the file.
+func RecordFile(ch rabbitmq.Channel, path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	r := NewRecorder(ch, NewWriter(f, FormatOf(path)))
+	r.closer = f.Close
+	return r, nil
+}
+
+// Err returns the first error writing to the capture. Recording stops after it.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) write(e Entry) {
+	e.Time = time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err == nil {
+		r.err = r.w.Write(e)
+	}
+}
+
+func (r *Recorder) Publish(exchange, routingKey string, body []byte) error {
+	return r.PublishWithOptions(exchange, routingKey, false, false, rabbitmq.Publishing{
+		ContentType: "application/octet-stream",
+		Body:        body,
+	})
+}
+
+func (r *Recorder) PublishWithOptions(exchange, routingKey string, mandatory, immediate bool, msg rabbitmq.Publishing) error {
+	if err := r.Channel.PublishWithOptions(exchange, routingKey, mandatory, immediate, msg); err != nil {
+		return err
+	}
+	r.write(Entry{Direction: Published, Exchange: exchange, RoutingKey: routingKey, Mandatory: mandatory, Message: msg})
+	return nil
+}
+
+func (r *Recorder) PublishWithContext(ctx context.Context, exchange, routingKey string, mandatory, immediate bool, msg rabbitmq.Publishing) error {
+	if err := r.Channel.PublishWithContext(ctx, exchange, routingKey, mandatory, immediate, msg); err != nil {
+		return err
+	}
+	r.write(Entry{Direction: Published, Exchange: exchange, RoutingKey: routingKey, Mandatory: mandatory, Message: msg})
+	return nil
+}
+
+// Consume records each delivery as it is handed to the caller.
+func (r *Recorder) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args rabbitmq.Table) (<-chan rabbitmq.Delivery, error) {
+	in, err := r.Channel.Consume(queue, consumer, autoAck, exclusive, noLocal, noWait, args)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan rabbitmq.Delivery)
+	go func() {
+		defer close(out)
+		for d := range in {
+			r.write(consumed(queue, d))
+			out <- d
+		}
+	}()
+	return out, nil
+}
+
+func (r *Recorder) Get(queue string, autoAck bool) (rabbitmq.Delivery, bool, error) {
+	d, ok, err := r.Channel.Get(queue, autoAck)
+	if ok && err == nil {
+		r.write(consumed(queue, d))
+	}
+	return d, ok, err
+}
+
+// Close closes the wrapped channel and the capture file RecordFile opened.
+func (r *Recorder) Close() error {
+	err := r.Channel.Close()
+	if r.closer != nil {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if cerr := r.closer(); err == nil {
+			err = cerr
+		}
+		r.closer = nil
+	}
+	return err
+}
+
+func consumed(queue string, d rabbitmq.Delivery) Entry {
+	return Entry{
+		Direction:   Consumed,
+		Exchange:    d.Exchange,
+		RoutingKey:  d.RoutingKey,
+		Queue:       queue,
+		Redelivered: d.Redelivered,
+		Message:     d.Publishing(),
+	}
+}
+
+var _ rabbitmq.Channel = (*Recorder)(nil)
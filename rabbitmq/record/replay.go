@@ -0,0 +1,110 @@
+package record
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eugene-ruby/xconnect/internal/topic"
+	"github.com/eugene-ruby/xconnect/rabbitmq"
+)
+
+// ReplayOptions select and pace the entries of a replay.
+type ReplayOptions struct {
+	// Direction keeps only published or consumed entries; empty keeps both.
+	Direction Direction
+	// Exchange keeps only entries of this exchange when set.
+	Exchange string
+	// RoutingKey keeps only entries whose routing key matches this topic
+	// pattern when set, where "*" stands for one word and "#" for any number.
+	RoutingKey string
+	// Filter, when set, keeps only entries it returns true for.
+	Filter func(Entry) bool
+	// Speed scales the recorded gaps between entries: 1 replays in real
+	// time, 2 twice as fast. Zero or less replays without delay.
+	Speed float64
+}
+
+// Select returns the entries opts keep, in order.
+func (opts ReplayOptions) Select(entries []Entry) []Entry {
+	var out []Entry
+	for _, e := range entries {
+		if opts.keep(e) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func (opts ReplayOptions) keep(e Entry) bool {
+	if opts.Direction != "" && e.Direction != opts.Direction {
+		return false
+	}
+	if opts.Exchange != "" && e.Exchange != opts.Exchange {
+		return false
+	}
+	if opts.RoutingKey != "" && !topic.Match(opts.RoutingKey, e.RoutingKey) {
+		return false
+	}
+	return opts.Filter == nil || opts.Filter(e)
+}
+
+// replay calls fn for each selected entry, sleeping the scaled recorded gap
+// before it. It stops when ctx is done or fn returns an error.
+func (opts ReplayOptions) replay(ctx context.Context, entries []Entry, fn func(i int, e Entry) error) error {
+	var prev time.Time
+	for i, e := range opts.Select(entries) {
+		if i > 0 && opts.Speed > 0 {
+			if gap := e.Time.Sub(prev); gap > 0 {
+				t := time.NewTimer(time.Duration(float64(gap) / opts.Speed))
+				select {
+				case <-ctx.Done():
+					t.Stop()
+					return ctx.Err()
+				case <-t.C:
+				}
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		prev = e.Time
+		if err := fn(i, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplayToHandler feeds the selected entries to h as deliveries, the way a
+// Worker would, with the delivery stored in the handler context. Deliveries
+// have no Acknowledger, so Ack, Nack and Reject return
+// rabbitmq.ErrDeliveryNotInitialized. Handler errors do not stop the replay;
+// they are returned joined once all entries are handled.
+func ReplayToHandler(ctx context.Context, entries []Entry, h rabbitmq.ContextHandlerFunc, opts ReplayOptions) error {
+	var errs []error
+	err := opts.replay(ctx, entries, func(i int, e Entry) error {
+		d := e.Delivery()
+		if herr := h(rabbitmq.ContextWithDelivery(ctx, d), d); herr != nil {
+			errs = append(errs, fmt.Errorf("record: entry %d (%s %s): %w", i+1, e.Exchange, e.RoutingKey, herr))
+		}
+		return nil
+	})
+	return errors.Join(append(errs, err)...)
+}
+
+// ReplayToChannel publishes the selected entries to ch with their recorded
+// exchange, routing key, mandatory flag and properties, except UserID, which
+// the broker refuses unless it names the connection's user. It stops at the
+// first publish error.
+func ReplayToChannel(ctx context.Context, ch rabbitmq.Channel, entries []Entry, opts ReplayOptions) error {
+	return opts.replay(ctx, entries, func(i int, e Entry) error {
+		msg := e.Message
+		msg.UserID = ""
+		if err := ch.PublishWithContext(ctx, e.Exchange, e.RoutingKey, e.Mandatory, false, msg); err != nil {
+			return fmt.Errorf("record: entry %d (%s %s): %w", i+1, e.Exchange, e.RoutingKey, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,138 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Headers set on messages moved by the retry subsystem.
+const (
+	RetryCountHeader      = "x-retry-count"       // number of retries made so far
+	RetryErrorHeader      = "x-retry-error"       // last handler error of a parked message
+	RetryQueueHeader      = "x-retry-queue"       // queue the message was consumed from
+	RetryExchangeHeader   = "x-retry-exchange"    // exchange the message was first published to
+	RetryRoutingKeyHeader = "x-retry-routing-key" // routing key the message was first published with
+)
+
+// DefaultRetryDelays is used when RetryConfig.Delays is empty.
+var DefaultRetryDelays = []time.Duration{time.Second, 10 * time.Second, time.Minute}
+
+// RetryConfig enables delayed retries of failed messages for a Worker.
+//
+// A failed message is republished to a retry queue whose TTL dead-letters it
+// back to the origin queue through the default exchange, and acked. After
+// MaxAttempts handler calls, or for Permanent errors, it is moved to the
+// parking queue instead. Requeue errors still nack the message straight back.
+type RetryConfig struct {
+	// Delays holds the wait before each retry. Attempts past the end reuse the
+	// last delay. Defaults to DefaultRetryDelays.
+	Delays []time.Duration
+	// MaxAttempts is the number of handler calls before a message is parked.
+	// Defaults to len(Delays)+1.
+	MaxAttempts int
+	// ParkingQueue receives messages that ran out of attempts. Defaults to
+	// the worker queue name with a ".dlq" suffix.
+	ParkingQueue string
+}
+
+func (c RetryConfig) delays() []time.Duration {
+	if len(c.Delays) == 0 {
+		return DefaultRetryDelays
+	}
+	return c.Delays
+}
+
+func (c RetryConfig) maxAttempts() int {
+	if c.MaxAttempts <= 0 {
+		return len(c.delays()) + 1
+	}
+	return c.MaxAttempts
+}
+
+func (c RetryConfig) parkingQueue(queue string) string {
+	if c.ParkingQueue == "" {
+		return queue + ".dlq"
+	}
+	return c.ParkingQueue
+}
+
+// RetryQueueName returns the name of the retry queue holding messages of
+// queue for delay: the queue name, ".retry." and the delay in whole
+// milliseconds followed by "ms", e.g. "orders.retry.30000ms". Delays are
+// truncated to milliseconds like the queue's x-message-ttl.
+func RetryQueueName(queue string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%dms", queue, delay.Milliseconds())
+}
+
+// DeclareRetryTopology declares the retry queues and the parking queue for queue.
+func DeclareRetryTopology(ch Channel, queue string, config RetryConfig) error {
+	for _, delay := range config.delays() {
+		_, err := ch.QueueDeclare(RetryQueueName(queue, delay), true, false, false, false, Table{
+			"x-message-ttl":             delay.Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": queue,
+		})
+		if err != nil {
+			return fmt.Errorf("retry: declare retry queue for %s: %w", delay, err)
+		}
+	}
+	if _, err := ch.QueueDeclare(config.parkingQueue(queue), true, false, false, false, nil); err != nil {
+		return fmt.Errorf("retry: declare parking queue: %w", err)
+	}
+	return nil
+}
+
+// RetryCount returns the number of retries recorded on d.
+func RetryCount(d Delivery) int {
+	switch n := d.Headers[RetryCountHeader].(type) {
+	case int:
+		return n
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	default:
+		return 0
+	}
+}
+
+// retry moves a failed msg to its next retry queue or to the parking queue,
+// then acks it. The message is nacked back to the queue when republishing fails.
+//
+// Republishing goes through the default exchange, so the exchange and routing
+// key of the first delivery are kept in headers. UserID is cleared because the
+// broker rejects publishes whose user-id differs from the connection's user.
+func (w *Worker) retry(msg Delivery, handlerErr error) error {
+	config := *w.config.Retry
+	retries := RetryCount(msg)
+
+	pub := msg.Publishing()
+	pub.UserID = ""
+	pub.Headers = withHeader(pub.Headers, RetryQueueHeader, w.config.Queue)
+	if _, ok := pub.Headers[RetryExchangeHeader]; !ok {
+		pub.Headers[RetryExchangeHeader] = msg.Exchange
+		pub.Headers[RetryRoutingKeyHeader] = msg.RoutingKey
+	}
+
+	var target string
+	if IsPermanent(handlerErr) || retries+1 >= config.maxAttempts() {
+		target = config.parkingQueue(w.config.Queue)
+		pub.Headers[RetryErrorHeader] = handlerErr.Error()
+	} else {
+		delays := config.delays()
+		target = RetryQueueName(w.config.Queue, delays[min(retries, len(delays)-1)])
+		pub.Headers[RetryCountHeader] = int64(retries + 1)
+	}
+
+	if err := w.channel.PublishWithOptions("", target, false, false, pub); err != nil {
+		if w.config.AutoAck {
+			return fmt.Errorf("retry: publish to %s: %w", target, err)
+		}
+		return fmt.Errorf("retry: publish to %s: %w", target, errors.Join(err, msg.Nack(true)))
+	}
+	if w.config.AutoAck {
+		return nil
+	}
+	return msg.Ack()
+}
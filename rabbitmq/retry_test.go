@@ -0,0 +1,150 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recordingChannel records declared queues and every publish.
+type recordingChannel struct {
+	*mockChannel
+	mu        sync.Mutex
+	declared  map[string]Table
+	publishes []mockPublish
+}
+
+func newRecordingChannel(messages chan Delivery) *recordingChannel {
+	return &recordingChannel{
+		mockChannel: &mockChannel{messages: messages},
+		declared:    make(map[string]Table),
+	}
+}
+
+func (r *recordingChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args Table) (Queue, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.declared[name] = args
+	return Queue{Name: name}, nil
+}
+
+func (r *recordingChannel) PublishWithOptions(exchange, routingKey string, mandatory, immediate bool, msg Publishing) error {
+	r.mu.Lock()
+	r.publishes = append(r.publishes, mockPublish{exchange: exchange, routingKey: routingKey, msg: msg})
+	r.mu.Unlock()
+	return r.mockChannel.PublishWithOptions(exchange, routingKey, mandatory, immediate, msg)
+}
+
+func TestDeclareRetryTopology(t *testing.T) {
+	ch := newRecordingChannel(nil)
+
+	err := DeclareRetryTopology(ch, "orders", RetryConfig{Delays: []time.Duration{time.Second, time.Minute}})
+	require.NoError(t, err)
+
+	require.Equal(t, map[string]Table{
+		"orders.retry.1000ms": {
+			"x-message-ttl":             int64(1000),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": "orders",
+		},
+		"orders.retry.60000ms": {
+			"x-message-ttl":             int64(60000),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": "orders",
+		},
+		"orders.dlq": nil,
+	}, ch.declared)
+}
+
+func TestWorker_RetryRoutesFailedMessages(t *testing.T) {
+	messages := make(chan Delivery, 4)
+	messages <- Delivery{DeliveryTag: 1, MessageID: "first-failure", UserID: "billing", Exchange: "events", RoutingKey: "order.created", Body: []byte("fail")}
+	messages <- Delivery{DeliveryTag: 2, RoutingKey: "orders", Headers: Table{
+		RetryCountHeader:      int32(2),
+		RetryExchangeHeader:   "events",
+		RetryRoutingKeyHeader: "order.paid",
+	}, Body: []byte("fail")}
+	messages <- Delivery{DeliveryTag: 3, Body: []byte("poison")}
+	messages <- Delivery{DeliveryTag: 4, Body: []byte("busy")}
+	close(messages)
+
+	ch := newRecordingChannel(messages)
+	worker := NewWorker(ch, WorkerConfig{
+		Queue: "orders",
+		Retry: &RetryConfig{Delays: []time.Duration{time.Second, 5 * time.Second}},
+		Handler: func(d Delivery) error {
+			switch string(d.Body) {
+			case "poison":
+				return Permanent(errors.New("cannot decode"))
+			case "busy":
+				return Requeue(errors.New("try again now"))
+			}
+			return errors.New("downstream unavailable")
+		},
+		OnError: func(error) {},
+	})
+	require.NoError(t, worker.Start(context.Background()))
+	worker.Wait()
+
+	require.Contains(t, ch.declared, "orders.retry.1000ms")
+	require.Len(t, ch.publishes, 3)
+
+	retried := ch.publishes[0]
+	require.Equal(t, "", retried.exchange)
+	require.Equal(t, "orders.retry.1000ms", retried.routingKey)
+	require.Equal(t, "first-failure", retried.msg.MessageID)
+	require.Equal(t, int64(1), retried.msg.Headers[RetryCountHeader])
+	require.Equal(t, "orders", retried.msg.Headers[RetryQueueHeader])
+	require.Equal(t, "events", retried.msg.Headers[RetryExchangeHeader])
+	require.Equal(t, "order.created", retried.msg.Headers[RetryRoutingKeyHeader])
+	require.Empty(t, retried.msg.UserID, "the publisher's user-id would be refused on this connection")
+
+	exhausted := ch.publishes[1]
+	require.Equal(t, "orders.dlq", exhausted.routingKey)
+	require.Equal(t, "downstream unavailable", exhausted.msg.Headers[RetryErrorHeader])
+	require.Equal(t, "events", exhausted.msg.Headers[RetryExchangeHeader], "the first origin survives retries")
+	require.Equal(t, "order.paid", exhausted.msg.Headers[RetryRoutingKeyHeader])
+
+	poison := ch.publishes[2]
+	require.Equal(t, "orders.dlq", poison.routingKey)
+	require.Equal(t, "cannot decode", poison.msg.Headers[RetryErrorHeader])
+
+	require.Equal(t, []uint64{1, 2, 3}, ch.acked)
+	require.Equal(t, []uint64{4}, ch.requeued)
+}
+
+func TestWorker_RetryNacksWhenRepublishFails(t *testing.T) {
+	messages := make(chan Delivery, 1)
+	messages <- Delivery{DeliveryTag: 1}
+	close(messages)
+
+	ch := newRecordingChannel(messages)
+	ch.publishErr = errors.New("channel closed")
+	worker := NewWorker(ch, WorkerConfig{
+		Queue:   "orders",
+		Retry:   &RetryConfig{},
+		Handler: func(d Delivery) error { return errors.New("failed") },
+		OnError: func(error) {},
+	})
+	require.NoError(t, worker.Start(context.Background()))
+	worker.Wait()
+
+	require.Empty(t, ch.acked)
+	require.Equal(t, []uint64{1}, ch.requeued)
+}
+
+func TestRetryCount(t *testing.T) {
+	require.Equal(t, 0, RetryCount(Delivery{}))
+	require.Equal(t, 3, RetryCount(Delivery{Headers: Table{RetryCountHeader: int64(3)}}))
+	require.Equal(t, 2, RetryCount(Delivery{Headers: Table{RetryCountHeader: int32(2)}}))
+}
+
+func TestRetryQueueName(t *testing.T) {
+	require.Equal(t, "orders.retry.1500ms", RetryQueueName("orders", 1500*time.Millisecond))
+	require.Equal(t, "orders.retry.60000ms", RetryQueueName("orders", time.Minute))
+	require.Equal(t, "orders.retry.0ms", RetryQueueName("orders", 500*time.Microsecond))
+}
@@ -0,0 +1,43 @@
+package rabbitmq
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrUnroutable is returned when the broker returns a mandatory publish that
+// matched no queue.
+var ErrUnroutable = errors.New("rabbitmq: message returned as unroutable")
+
+// Reply codes the broker uses for returned messages.
+const (
+	ReplyNoRoute     uint16 = 312
+	ReplyNoConsumers uint16 = 313
+)
+
+// Return is a message the broker sent back because it could not be routed
+// (mandatory) or delivered to a consumer (immediate).
+type Return struct {
+	ReplyCode  uint16 // reason the message was returned
+	ReplyText  string // description of the reason
+	Exchange   string // exchange the message was published to
+	RoutingKey string // routing key the message was published with
+
+	Headers Table // application or headers exchange table
+
+	// Properties
+	ContentType     string    // MIME content type
+	ContentEncoding string    // MIME content encoding
+	DeliveryMode    uint8     // transient (1) or persistent (2)
+	Priority        uint8     // 0 to 9
+	CorrelationID   string    // correlation identifier
+	ReplyTo         string    // address to reply to (ex: RPC)
+	Expiration      string    // message expiration spec
+	MessageID       string    // message identifier
+	Timestamp       time.Time // message timestamp
+	Type            string    // message type name
+	UserID          string    // creating user
+	AppID           string    // creating application
+
+	Body []byte
+}
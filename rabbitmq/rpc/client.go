@@ -0,0 +1,184 @@
+// Package rpc implements request/reply over RabbitMQ using direct reply-to.
+package rpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eugene-ruby/xconnect/rabbitmq"
+)
+
+// DirectReplyTo is the pseudo-queue RabbitMQ routes replies through without declaring a queue.
+const DirectReplyTo = "amq.rabbitmq.reply-to"
+
+// ErrorHeader carries the error message of a failed call in a reply.
+const ErrorHeader = "x-rpc-error"
+
+var (
+	// ErrTimeout is returned when no reply arrives before the deadline.
+	ErrTimeout = errors.New("rpc: timed out waiting for reply")
+	// ErrClientClosed is returned by calls made or pending when the client stops.
+	ErrClientClosed = errors.New("rpc: client closed")
+)
+
+// RemoteError is returned when the server replied with an error.
+type RemoteError struct {
+	Message string
+	Reply   rabbitmq.Delivery
+}
+
+func (e *RemoteError) Error() string {
+	return "rpc: remote error: " + e.Message
+}
+
+// ClientConfig holds configuration for a Client.
+type ClientConfig struct {
+	// Timeout bounds every call in addition to its context. Zero relies on the context only.
+	Timeout time.Duration
+}
+
+// Client sends requests and waits for their replies. It is safe for
+// concurrent use; replies are matched to calls by correlation ID.
+type Client struct {
+	ch     rabbitmq.Channel
+	config ClientConfig
+	prefix string
+	seq    atomic.Uint64
+
+	mu      sync.Mutex
+	pending map[string]chan reply
+	closed  bool
+}
+
+type reply struct {
+	d   rabbitmq.Delivery
+	err error
+}
+
+// NewClient starts consuming replies on ch. The channel should be dedicated
+// to the client: direct reply-to requires requests to be published on the
+// channel that consumes the replies.
+func NewClient(ch rabbitmq.Channel, config ClientConfig) (*Client, error) {
+	replies, err := ch.Consume(DirectReplyTo, "", true, false, false, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("rpc: consume replies: %w", err)
+	}
+
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	c := &Client{
+		ch:      ch,
+		config:  config,
+		prefix:  hex.EncodeToString(b[:]),
+		pending: make(map[string]chan reply),
+	}
+	returns := ch.NotifyReturn(make(chan rabbitmq.Return, 16))
+	go c.listen(replies, returns)
+	return c, nil
+}
+
+// Call publishes body as a request and waits for the reply.
+func (c *Client) Call(ctx context.Context, exchange, routingKey string, body []byte) (rabbitmq.Delivery, error) {
+	return c.CallWithOptions(ctx, exchange, routingKey, rabbitmq.Publishing{
+		ContentType: "application/octet-stream",
+		Body:        body,
+	})
+}
+
+// CallWithOptions publishes msg as a request and waits for the reply. The
+// request is published as mandatory, so a call nobody can receive fails
+// with rabbitmq.ErrUnroutable. ReplyTo and CorrelationID are set by the client.
+func (c *Client) CallWithOptions(ctx context.Context, exchange, routingKey string, msg rabbitmq.Publishing) (rabbitmq.Delivery, error) {
+	if c.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.Timeout)
+		defer cancel()
+	}
+
+	id := c.prefix + "-" + strconv.FormatUint(c.seq.Add(1), 10)
+	done := make(chan reply, 1)
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return rabbitmq.Delivery{}, ErrClientClosed
+	}
+	c.pending[id] = done
+	c.mu.Unlock()
+	defer c.forget(id)
+
+	msg.ReplyTo = DirectReplyTo
+	msg.CorrelationID = id
+	if err := c.ch.PublishWithContext(ctx, exchange, routingKey, true, false, msg); err != nil {
+		return rabbitmq.Delivery{}, fmt.Errorf("rpc: publish request: %w", err)
+	}
+
+	select {
+	case r := <-done:
+		return r.d, r.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return rabbitmq.Delivery{}, fmt.Errorf("%w: %w", ErrTimeout, ctx.Err())
+		}
+		return rabbitmq.Delivery{}, ctx.Err()
+	}
+}
+
+// Close stops the client and closes its channel. Pending calls fail with ErrClientClosed.
+func (c *Client) Close() error {
+	return c.ch.Close()
+}
+
+func (c *Client) forget(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, id)
+}
+
+// listen resolves pending calls from replies and returned requests until the
+// reply consumer stops.
+func (c *Client) listen(replies <-chan rabbitmq.Delivery, returns <-chan rabbitmq.Return) {
+	for replies != nil {
+		select {
+		case d, ok := <-replies:
+			if !ok {
+				replies = nil
+				continue
+			}
+			var err error
+			if msg, ok := d.Headers[ErrorHeader].(string); ok {
+				err = &RemoteError{Message: msg, Reply: d}
+			}
+			c.resolve(d.CorrelationID, reply{d: d, err: err})
+		case r, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			c.resolve(r.CorrelationID, reply{err: fmt.Errorf("rpc: %w (%d %s)", rabbitmq.ErrUnroutable, r.ReplyCode, r.ReplyText)})
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for id, done := range c.pending {
+		done <- reply{err: ErrClientClosed}
+		delete(c.pending, id)
+	}
+}
+
+func (c *Client) resolve(id string, r reply) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if done, ok := c.pending[id]; ok {
+		done <- r
+		delete(c.pending, id)
+	}
+}
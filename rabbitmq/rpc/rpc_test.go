@@ -0,0 +1,147 @@
+package rpc_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eugene-ruby/xconnect/rabbitmq"
+	"github.com/eugene-ruby/xconnect/rabbitmq/mocks"
+	"github.com/eugene-ruby/xconnect/rabbitmq/rpc"
+	"github.com/stretchr/testify/require"
+)
+
+// loopback is a MockChannel that hands every publish to onPublish.
+type loopback struct {
+	*mocks.MockChannel
+	onPublish func(exchange, routingKey string, msg rabbitmq.Publishing)
+}
+
+func (l *loopback) PublishWithContext(ctx context.Context, exchange, routingKey string, mandatory, immediate bool, msg rabbitmq.Publishing) error {
+	return l.PublishWithOptions(exchange, routingKey, mandatory, immediate, msg)
+}
+
+func (l *loopback) PublishWithOptions(exchange, routingKey string, mandatory, immediate bool, msg rabbitmq.Publishing) error {
+	l.onPublish(exchange, routingKey, msg)
+	return nil
+}
+
+// echo replies asynchronously to every request with its body plus "!".
+func echo(ch *mocks.MockChannel) func(exchange, routingKey string, msg rabbitmq.Publishing) {
+	return func(exchange, routingKey string, msg rabbitmq.Publishing) {
+		go func() {
+			body := []byte(string(msg.Body) + "!")
+			ch.ConsumeMessages <- rabbitmq.Delivery{CorrelationID: msg.CorrelationID, RoutingKey: msg.ReplyTo, Body: body}
+		}()
+	}
+}
+
+func TestClient_ConcurrentCalls(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	client, err := rpc.NewClient(&loopback{MockChannel: mock, onPublish: echo(mock)}, rpc.ClientConfig{Timeout: time.Second})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for _, body := range []string{"a", "b", "c", "d"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reply, err := client.Call(context.Background(), "rpc", "echo", []byte(body))
+			require.NoError(t, err)
+			require.Equal(t, body+"!", string(reply.Body))
+			require.Equal(t, rpc.DirectReplyTo, reply.RoutingKey)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestClient_Timeout(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	client, err := rpc.NewClient(&loopback{MockChannel: mock, onPublish: func(string, string, rabbitmq.Publishing) {}},
+		rpc.ClientConfig{Timeout: 10 * time.Millisecond})
+	require.NoError(t, err)
+
+	_, err = client.Call(context.Background(), "rpc", "slow", nil)
+	require.ErrorIs(t, err, rpc.ErrTimeout)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestClient_RemoteErrorAndUnroutable(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	ch := &loopback{MockChannel: mock}
+	ch.onPublish = func(exchange, routingKey string, msg rabbitmq.Publishing) {
+		go func() {
+			if routingKey == "missing" {
+				mock.SendReturn(rabbitmq.Return{ReplyCode: rabbitmq.ReplyNoRoute, ReplyText: "NO_ROUTE", CorrelationID: msg.CorrelationID})
+				return
+			}
+			mock.ConsumeMessages <- rabbitmq.Delivery{
+				CorrelationID: msg.CorrelationID,
+				Headers:       rabbitmq.Table{rpc.ErrorHeader: "order not found"},
+			}
+		}()
+	}
+	client, err := rpc.NewClient(ch, rpc.ClientConfig{Timeout: time.Second})
+	require.NoError(t, err)
+
+	_, err = client.Call(context.Background(), "rpc", "lookup", nil)
+	var remote *rpc.RemoteError
+	require.ErrorAs(t, err, &remote)
+	require.Equal(t, "order not found", remote.Message)
+
+	_, err = client.Call(context.Background(), "rpc", "missing", nil)
+	require.ErrorIs(t, err, rabbitmq.ErrUnroutable)
+}
+
+func TestClient_Close(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	client, err := rpc.NewClient(&loopback{MockChannel: mock, onPublish: func(string, string, rabbitmq.Publishing) {
+		close(mock.ConsumeMessages)
+	}}, rpc.ClientConfig{})
+	require.NoError(t, err)
+
+	_, err = client.Call(context.Background(), "rpc", "echo", nil)
+	require.ErrorIs(t, err, rpc.ErrClientClosed)
+
+	_, err = client.Call(context.Background(), "rpc", "echo", nil)
+	require.ErrorIs(t, err, rpc.ErrClientClosed)
+}
+
+func TestServer_RepliesToCaller(t *testing.T) {
+	mock := mocks.NewMockChannel()
+	replies := make(chan rabbitmq.Publishing, 3)
+	ch := &loopback{MockChannel: mock, onPublish: func(exchange, routingKey string, msg rabbitmq.Publishing) {
+		require.Equal(t, "", exchange)
+		require.Equal(t, rpc.DirectReplyTo, routingKey)
+		replies <- msg
+	}}
+
+	server := rpc.NewServer(ch, rabbitmq.WorkerConfig{Queue: "rpc.echo", OnError: func(error) {}},
+		func(ctx context.Context, req rabbitmq.Delivery) (rabbitmq.Publishing, error) {
+			if string(req.Body) == "fail" {
+				return rabbitmq.Publishing{}, errors.New("bad request")
+			}
+			return rabbitmq.Publishing{Body: append(req.Body, '!')}, nil
+		})
+
+	mock.ConsumeMessages <- rabbitmq.Delivery{ReplyTo: rpc.DirectReplyTo, CorrelationID: "1", Body: []byte("hi")}
+	mock.ConsumeMessages <- rabbitmq.Delivery{ReplyTo: rpc.DirectReplyTo, CorrelationID: "2", Body: []byte("fail")}
+	mock.ConsumeMessages <- rabbitmq.Delivery{Body: []byte("no reply wanted")}
+	close(mock.ConsumeMessages)
+
+	require.NoError(t, server.Start(context.Background()))
+	server.Wait()
+
+	ok := <-replies
+	require.Equal(t, "1", ok.CorrelationID)
+	require.Equal(t, []byte("hi!"), ok.Body)
+
+	failed := <-replies
+	require.Equal(t, "2", failed.CorrelationID)
+	require.Equal(t, "bad request", failed.Headers[rpc.ErrorHeader])
+	require.Empty(t, replies)
+
+	require.Len(t, mock.Acked(), 3)
+}
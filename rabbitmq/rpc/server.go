@@ -0,0 +1,43 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/eugene-ruby/xconnect/rabbitmq"
+)
+
+// HandlerFunc handles a request and returns the reply to send.
+//
+// A returned error is sent to the caller as a RemoteError and the request is
+// acked, except for errors wrapped with rabbitmq.Requeue: those requeue the
+// request without replying.
+type HandlerFunc func(ctx context.Context, req rabbitmq.Delivery) (rabbitmq.Publishing, error)
+
+// Server is a Worker that replies to every request carrying a ReplyTo address.
+type Server struct {
+	*rabbitmq.Worker
+}
+
+// NewServer returns a Server consuming the queue in config. Replies are
+// published on channel; the Handler and ContextHandler fields of config are
+// replaced by handler.
+func NewServer(channel rabbitmq.Channel, config rabbitmq.WorkerConfig, handler HandlerFunc) *Server {
+	config.Handler = nil
+	config.ContextHandler = func(ctx context.Context, d rabbitmq.Delivery) error {
+		resp, err := handler(ctx, d)
+		if d.ReplyTo == "" || rabbitmq.IsRequeue(err) {
+			return err
+		}
+
+		if err != nil {
+			resp = rabbitmq.Publishing{Headers: rabbitmq.Table{ErrorHeader: err.Error()}}
+		}
+		resp.CorrelationID = d.CorrelationID
+		if perr := channel.PublishWithOptions("", d.ReplyTo, false, false, resp); perr != nil {
+			return rabbitmq.Requeue(fmt.Errorf("rpc: publish reply: %w", perr))
+		}
+		return nil
+	}
+	return &Server{Worker: rabbitmq.NewWorker(channel, config)}
+}
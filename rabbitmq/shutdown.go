@@ -0,0 +1,216 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultShutdownTimeout bounds a worker shutdown when WorkerConfig.ShutdownTimeout is zero.
+const DefaultShutdownTimeout = 30 * time.Second
+
+// ErrShutdownTimeout is wrapped by a ShutdownError when handlers were still
+// running at the shutdown deadline.
+var ErrShutdownTimeout = errors.New("worker: shutdown deadline exceeded")
+
+// ShutdownError reports the messages a Worker did not process during shutdown.
+type ShutdownError struct {
+	// Requeued holds the delivery tags of received messages the worker had not
+	// started to handle. They were nacked back onto the queue.
+	Requeued []uint64
+	// Abandoned holds the delivery tags of messages whose handlers were still
+	// running at the deadline.
+	Abandoned []uint64
+	// Err wraps ErrShutdownTimeout when the deadline passed.
+	Err error
+}
+
+func (e *ShutdownError) Error() string {
+	msg := fmt.Sprintf("worker: shutdown requeued %d and abandoned %d messages", len(e.Requeued), len(e.Abandoned))
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *ShutdownError) Unwrap() error { return e.Err }
+
+// Shutdown stops the worker gracefully: it cancels the consumer, requeues
+// messages it received but did not start to handle, and waits for running
+// handlers until ctx is done or ShutdownTimeout elapses. It returns nil when
+// every received message was handled, and a *ShutdownError otherwise.
+//
+// A drain already started by cancelling the context passed to Start also
+// ends when ctx is done.
+func (w *Worker) Shutdown(ctx context.Context) error {
+	w.beginShutdown(ctx)
+	stop := context.AfterFunc(ctx, w.drainCancel)
+	defer stop()
+	w.wg.Wait()
+
+	w.resultMu.Lock()
+	defer w.resultMu.Unlock()
+	return w.result
+}
+
+func (w *Worker) beginShutdown(ctx context.Context) {
+	w.stopOnce.Do(func() {
+		w.drainCtx, w.drainCancel = context.WithCancel(ctx)
+		close(w.stop)
+	})
+}
+
+func (w *Worker) stopping() bool {
+	select {
+	case <-w.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *Worker) setResult(err error) {
+	w.resultMu.Lock()
+	defer w.resultMu.Unlock()
+	w.result = err
+}
+
+// drain cancels the consumer, requeues the messages left in msgs, starting
+// with pending when set, and waits for running handlers until the deadline.
+func (w *Worker) drain(msgs <-chan Delivery, pending *Delivery, pool *handlerPool) error {
+	timeout := w.config.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	defer w.drainCancel()
+	ctx, cancel := context.WithTimeout(w.drainCtx, timeout)
+	defer cancel()
+
+	w.logger.Info("canceling consumer")
+	_ = w.channel.Cancel(w.config.ConsumerTag, false)
+
+	var requeued, abandoned []uint64
+	leftover := func(msg Delivery) {
+		if !w.config.AutoAck {
+			if err := msg.Nack(true); err != nil {
+				w.logDelivery(ctx, "requeue failed", msg, err)
+			}
+			requeued = append(requeued, msg.DeliveryTag)
+			return
+		}
+		// The broker already considers an auto-acked message delivered, so
+		// handle it rather than lose it.
+		select {
+		case pool.slots <- struct{}{}:
+			pool.run(msg, w.handle)
+		case <-ctx.Done():
+			abandoned = append(abandoned, msg.DeliveryTag)
+		}
+	}
+
+	if pending != nil {
+		leftover(*pending)
+	}
+loop:
+	for {
+		select {
+		case msg, ok := <-msgs:
+			if !ok {
+				break loop
+			}
+			leftover(msg)
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	abandoned = append(abandoned, pool.wait(ctx)...)
+	// Tell handlers still running that the worker gave up on them.
+	pool.cancel()
+
+	if len(requeued) == 0 && len(abandoned) == 0 {
+		return nil
+	}
+	err := &ShutdownError{Requeued: requeued, Abandoned: abandoned}
+	if ctx.Err() != nil {
+		err.Err = fmt.Errorf("%w: %w", ErrShutdownTimeout, ctx.Err())
+	}
+	return err
+}
+
+// handlerPool runs handlers on a bounded number of goroutines and tracks the
+// messages they are processing. Callers acquire a slot before run.
+type handlerPool struct {
+	ctx    context.Context // parent of every handler context
+	cancel context.CancelFunc
+	slots  chan struct{}
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	seq     int
+	running map[int]uint64
+}
+
+// newHandlerPool returns a pool whose handler contexts keep the values of ctx
+// but are cancelled only by the pool, so that cancelling the worker's context
+// starts a drain without interrupting running handlers.
+func newHandlerPool(ctx context.Context, size int) *handlerPool {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	return &handlerPool{
+		ctx:     ctx,
+		cancel:  cancel,
+		slots:   make(chan struct{}, size),
+		running: make(map[int]uint64),
+	}
+}
+
+// run handles msg with fn on a new goroutine and frees the slot when done.
+func (p *handlerPool) run(msg Delivery, fn func(context.Context, Delivery)) {
+	p.mu.Lock()
+	p.seq++
+	id := p.seq
+	p.running[id] = msg.DeliveryTag
+	p.mu.Unlock()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer func() { <-p.slots }()
+		fn(p.ctx, msg)
+
+		p.mu.Lock()
+		delete(p.running, id)
+		p.mu.Unlock()
+	}()
+}
+
+// wait blocks until every handler finished or ctx is done, and returns the
+// delivery tags of handlers still running. A nil ctx waits without a deadline.
+func (p *handlerPool) wait(ctx context.Context) []uint64 {
+	if ctx == nil {
+		p.wg.Wait()
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	tags := make([]uint64, 0, len(p.running))
+	for _, tag := range p.running {
+		tags = append(tags, tag)
+	}
+	slices.Sort(tags)
+	return tags
+}
@@ -2,3 +2,13 @@ package rabbitmq
 
 // Table defines arguments passed to exchanges and queues.
 type Table map[string]interface{}
+
+// withHeader returns a copy of headers with key set to value.
+func withHeader(headers Table, key string, value interface{}) Table {
+	out := make(Table, len(headers)+1)
+	for k, v := range headers {
+		out[k] = v
+	}
+	out[key] = value
+	return out
+}
@@ -0,0 +1,217 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/eugene-ruby/xconnect/internal/table"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrPreconditionFailed is wrapped by declare and bind errors when the broker
+// refuses them with PRECONDITION_FAILED, typically because the entity already
+// exists with different settings. The broker closes the channel afterwards.
+var ErrPreconditionFailed = errors.New("rabbitmq: precondition failed")
+
+// Exchange kinds.
+const (
+	ExchangeDirect  = "direct"
+	ExchangeFanout  = "fanout"
+	ExchangeTopic   = "topic"
+	ExchangeHeaders = "headers"
+)
+
+// Queue types set through QueueSpec.Type.
+const (
+	QueueClassic = "classic"
+	QueueQuorum  = "quorum"
+	QueueStream  = "stream"
+)
+
+// Binding destination types.
+const (
+	DestinationQueue    = "queue"
+	DestinationExchange = "exchange"
+)
+
+// Topology describes exchanges, queues and the bindings between them.
+// It can be built in code or loaded with ParseTopology and LoadTopology.
+type Topology struct {
+	Exchanges []ExchangeSpec `yaml:"exchanges"`
+	Queues    []QueueSpec    `yaml:"queues"`
+	Bindings  []BindingSpec  `yaml:"bindings"`
+}
+
+// ExchangeSpec describes an exchange declaration.
+type ExchangeSpec struct {
+	Name       string `yaml:"name"`
+	Kind       string `yaml:"kind"` // defaults to ExchangeDirect
+	Durable    bool   `yaml:"durable"`
+	AutoDelete bool   `yaml:"autoDelete"`
+	Internal   bool   `yaml:"internal"`
+	Args       Table  `yaml:"args"`
+}
+
+// QueueSpec describes a queue declaration. The typed fields are shorthands
+// for the matching x-arguments and take precedence over Args.
+type QueueSpec struct {
+	Name       string `yaml:"name"`
+	Durable    bool   `yaml:"durable"`
+	AutoDelete bool   `yaml:"autoDelete"`
+	Exclusive  bool   `yaml:"exclusive"`
+
+	Type                 string        `yaml:"type"`                 // x-queue-type
+	MessageTTL           time.Duration `yaml:"messageTTL"`           // x-message-ttl
+	MaxLength            int           `yaml:"maxLength"`            // x-max-length
+	DeadLetterExchange   string        `yaml:"deadLetterExchange"`   // x-dead-letter-exchange
+	DeadLetterRoutingKey string        `yaml:"deadLetterRoutingKey"` // x-dead-letter-routing-key
+
+	Args Table `yaml:"args"`
+}
+
+// BindingSpec binds Destination to the Source exchange.
+type BindingSpec struct {
+	Source          string `yaml:"source"`
+	Destination     string `yaml:"destination"`
+	DestinationType string `yaml:"destinationType"` // DestinationQueue (default) or DestinationExchange
+	RoutingKey      string `yaml:"routingKey"`
+	Args            Table  `yaml:"args"`
+}
+
+// DeclareError reports the entity a declaration or binding failed on.
+type DeclareError struct {
+	Entity string // "exchange", "queue" or "binding"
+	Name   string
+	Err    error
+}
+
+func (e *DeclareError) Error() string {
+	return fmt.Sprintf("topology: declare %s %q: %v", e.Entity, e.Name, e.Err)
+}
+
+func (e *DeclareError) Unwrap() error { return e.Err }
+
+// ParseTopology decodes a Topology from YAML or JSON. Durations such as
+// messageTTL are written as strings like "30s".
+func ParseTopology(data []byte) (Topology, error) {
+	var t Topology
+	if err := yaml.Unmarshal(data, &t); err != nil {
+		return Topology{}, fmt.Errorf("topology: %w", err)
+	}
+	for i := range t.Exchanges {
+		t.Exchanges[i].Args = table.Normalize(t.Exchanges[i].Args)
+	}
+	for i := range t.Queues {
+		t.Queues[i].Args = table.Normalize(t.Queues[i].Args)
+	}
+	for i := range t.Bindings {
+		t.Bindings[i].Args = table.Normalize(t.Bindings[i].Args)
+	}
+	if err := t.Validate(); err != nil {
+		return Topology{}, err
+	}
+	return t, nil
+}
+
+// LoadTopology reads and parses a YAML or JSON topology file.
+func LoadTopology(path string) (Topology, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Topology{}, fmt.Errorf("topology: %w", err)
+	}
+	return ParseTopology(data)
+}
+
+// Validate checks that every entity is named and every binding is complete.
+func (t Topology) Validate() error {
+	for i, e := range t.Exchanges {
+		if e.Name == "" {
+			return fmt.Errorf("topology: exchange %d has no name", i)
+		}
+	}
+	for i, q := range t.Queues {
+		if q.Name == "" {
+			return fmt.Errorf("topology: queue %d has no name", i)
+		}
+	}
+	for i, b := range t.Bindings {
+		if b.Source == "" || b.Destination == "" {
+			return fmt.Errorf("topology: binding %d needs a source and a destination", i)
+		}
+		switch b.DestinationType {
+		case "", DestinationQueue, DestinationExchange:
+		default:
+			return fmt.Errorf("topology: binding %d has unknown destination type %q", i, b.DestinationType)
+		}
+	}
+	return nil
+}
+
+// Apply declares the exchanges, then the queues, then the bindings, in the
+// order they are listed. Declarations are idempotent, so Apply can run on
+// every start; it stops at the first failure and returns a *DeclareError.
+func (t Topology) Apply(ch Channel) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	for _, e := range t.Exchanges {
+		kind := e.Kind
+		if kind == "" {
+			kind = ExchangeDirect
+		}
+		if err := ch.ExchangeDeclare(e.Name, kind, e.Durable, e.AutoDelete, e.Internal, false, e.Args); err != nil {
+			return &DeclareError{Entity: "exchange", Name: e.Name, Err: err}
+		}
+	}
+	for _, q := range t.Queues {
+		if _, err := ch.QueueDeclare(q.Name, q.Durable, q.AutoDelete, q.Exclusive, false, q.args()); err != nil {
+			return &DeclareError{Entity: "queue", Name: q.Name, Err: err}
+		}
+	}
+	for _, b := range t.Bindings {
+		var err error
+		if b.DestinationType == DestinationExchange {
+			err = ch.ExchangeBind(b.Destination, b.RoutingKey, b.Source, false, b.Args)
+		} else {
+			err = ch.QueueBind(b.Destination, b.RoutingKey, b.Source, false, b.Args)
+		}
+		if err != nil {
+			return &DeclareError{Entity: "binding", Name: b.String(), Err: err}
+		}
+	}
+	return nil
+}
+
+// String describes the binding as "source -> destination (routing key)".
+func (b BindingSpec) String() string {
+	return fmt.Sprintf("%s -> %s (%s)", b.Source, b.Destination, b.RoutingKey)
+}
+
+// args merges the typed shorthands into a copy of Args.
+func (q QueueSpec) args() Table {
+	args := make(Table, len(q.Args)+5)
+	for k, v := range q.Args {
+		args[k] = v
+	}
+	if q.Type != "" {
+		args["x-queue-type"] = q.Type
+	}
+	if q.MessageTTL > 0 {
+		args["x-message-ttl"] = q.MessageTTL.Milliseconds()
+	}
+	if q.MaxLength > 0 {
+		args["x-max-length"] = int64(q.MaxLength)
+	}
+	if q.DeadLetterExchange != "" {
+		args["x-dead-letter-exchange"] = q.DeadLetterExchange
+	}
+	if q.DeadLetterRoutingKey != "" {
+		args["x-dead-letter-routing-key"] = q.DeadLetterRoutingKey
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return args
+}
@@ -0,0 +1,249 @@
+package rabbitmq
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/require"
+)
+
+// topologyChannel records declarations and bindings in the order they are made.
+type topologyChannel struct {
+	*mockChannel
+	calls   []string
+	queues  map[string]Table
+	failing string // entity name whose declaration fails
+}
+
+func newTopologyChannel() *topologyChannel {
+	return &topologyChannel{mockChannel: &mockChannel{}, queues: make(map[string]Table)}
+}
+
+func (c *topologyChannel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args Table) error {
+	c.calls = append(c.calls, fmt.Sprintf("exchange %s %s durable=%t internal=%t", name, kind, durable, internal))
+	return nil
+}
+
+func (c *topologyChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args Table) (Queue, error) {
+	if name == c.failing {
+		return Queue{}, fmt.Errorf("%w: %w", ErrPreconditionFailed, &amqp.Error{Code: amqp.PreconditionFailed, Reason: "inequivalent arg 'x-queue-type'"})
+	}
+	c.calls = append(c.calls, "queue "+name)
+	c.queues[name] = args
+	return Queue{Name: name}, nil
+}
+
+func (c *topologyChannel) QueueBind(name, key, exchange string, noWait bool, args Table) error {
+	c.calls = append(c.calls, fmt.Sprintf("bind queue %s <- %s (%s)", name, exchange, key))
+	return nil
+}
+
+func (c *topologyChannel) ExchangeBind(destination, key, source string, noWait bool, args Table) error {
+	c.calls = append(c.calls, fmt.Sprintf("bind exchange %s <- %s (%s)", destination, source, key))
+	return nil
+}
+
+const topologyYAML = `
+exchanges:
+  - name: events
+    kind: topic
+    durable: true
+  - name: orders
+    kind: topic
+    durable: true
+    internal: true
+queues:
+  - name: orders.created
+    durable: true
+    type: quorum
+    messageTTL: 30s
+    maxLength: 1000
+    deadLetterExchange: dlx
+    args:
+      x-overflow: reject-publish
+      x-max-length-bytes: 1048576
+bindings:
+  - source: orders
+    destination: orders.created
+    routingKey: order.created
+  - source: events
+    destination: orders
+    destinationType: exchange
+    routingKey: "order.#"
+`
+
+func TestTopology_ParseAndApply(t *testing.T) {
+	topology, err := ParseTopology([]byte(topologyYAML))
+	require.NoError(t, err)
+
+	ch := newTopologyChannel()
+	require.NoError(t, topology.Apply(ch))
+	require.Equal(t, []string{
+		"exchange events topic durable=true internal=false",
+		"exchange orders topic durable=true internal=true",
+		"queue orders.created",
+		"bind queue orders.created <- orders (order.created)",
+		"bind exchange orders <- events (order.#)",
+	}, ch.calls)
+	require.Equal(t, Table{
+		"x-queue-type":           QueueQuorum,
+		"x-message-ttl":          int64(30000),
+		"x-max-length":           int64(1000),
+		"x-dead-letter-exchange": "dlx",
+		"x-overflow":             "reject-publish",
+		"x-max-length-bytes":     int64(1048576),
+	}, ch.queues["orders.created"])
+}
+
+func TestTopology_ParseJSON(t *testing.T) {
+	topology, err := ParseTopology([]byte(`{
+		"exchanges": [{"name": "events"}],
+		"queues": [{"name": "audit", "messageTTL": "1m"}],
+		"bindings": [{"source": "events", "destination": "audit", "routingKey": "#"}]
+	}`))
+	require.NoError(t, err)
+	require.Equal(t, Topology{
+		Exchanges: []ExchangeSpec{{Name: "events"}},
+		Queues:    []QueueSpec{{Name: "audit", MessageTTL: time.Minute}},
+		Bindings:  []BindingSpec{{Source: "events", Destination: "audit", RoutingKey: "#"}},
+	}, topology)
+
+	ch := newTopologyChannel()
+	require.NoError(t, topology.Apply(ch))
+	require.Equal(t, "exchange events direct durable=false internal=false", ch.calls[0])
+}
+
+func TestTopology_Invalid(t *testing.T) {
+	_, err := ParseTopology([]byte("bindings:\n  - source: events\n"))
+	require.ErrorContains(t, err, "binding 0 needs a source and a destination")
+
+	_, err = ParseTopology([]byte("bindings:\n  - {source: a, destination: b, destinationType: topic}\n"))
+	require.ErrorContains(t, err, `unknown destination type "topic"`)
+
+	_, err = ParseTopology([]byte("queues: [{name: q, messageTTL: soon}]"))
+	require.Error(t, err)
+}
+
+func TestTopology_ApplyReportsConflictingEntity(t *testing.T) {
+	ch := newTopologyChannel()
+	ch.failing = "payments"
+
+	err := Topology{Queues: []QueueSpec{
+		{Name: "orders"},
+		{Name: "payments", Type: QueueQuorum},
+		{Name: "refunds"},
+	}}.Apply(ch)
+
+	var declareErr *DeclareError
+	require.ErrorAs(t, err, &declareErr)
+	require.Equal(t, "queue", declareErr.Entity)
+	require.Equal(t, "payments", declareErr.Name)
+	require.ErrorIs(t, err, ErrPreconditionFailed)
+	require.Equal(t, []string{"queue orders"}, ch.calls)
+}
+
+func TestErrorFromAMQP(t *testing.T) {
+	conflict := &amqp.Error{Code: amqp.PreconditionFailed, Reason: "PRECONDITION_FAILED - inequivalent arg 'durable'"}
+	err := errorFromAMQP(conflict)
+	require.ErrorIs(t, err, ErrPreconditionFailed)
+	var amqpErr *amqp.Error
+	require.ErrorAs(t, err, &amqpErr)
+
+	notFound := &amqp.Error{Code: amqp.NotFound}
+	require.Same(t, notFound, errorFromAMQP(notFound))
+	require.NoError(t, errorFromAMQP(nil))
+
+	require.False(t, errors.Is(errorFromAMQP(notFound), ErrPreconditionFailed))
+}
+
+// failingAMQPChannel fails every broker operation with err.
+type failingAMQPChannel struct {
+	amqpChannel
+	err error
+}
+
+func (f failingAMQPChannel) ExchangeDeclare(string, string, bool, bool, bool, bool, amqp.Table) error {
+	return f.err
+}
+func (f failingAMQPChannel) ExchangeDelete(string, bool, bool) error { return f.err }
+func (f failingAMQPChannel) ExchangeBind(string, string, string, bool, amqp.Table) error {
+	return f.err
+}
+func (f failingAMQPChannel) ExchangeUnbind(string, string, string, bool, amqp.Table) error {
+	return f.err
+}
+func (f failingAMQPChannel) QueueDeclare(string, bool, bool, bool, bool, amqp.Table) (amqp.Queue, error) {
+	return amqp.Queue{}, f.err
+}
+func (f failingAMQPChannel) QueueInspect(string) (amqp.Queue, error)                  { return amqp.Queue{}, f.err }
+func (f failingAMQPChannel) QueueBind(string, string, string, bool, amqp.Table) error { return f.err }
+func (f failingAMQPChannel) QueueUnbind(string, string, string, amqp.Table) error     { return f.err }
+func (f failingAMQPChannel) QueuePurge(string, bool) (int, error)                     { return 0, f.err }
+func (f failingAMQPChannel) QueueDelete(string, bool, bool, bool) (int, error)        { return 0, f.err }
+func (f failingAMQPChannel) Publish(string, string, bool, bool, amqp.Publishing) error {
+	return f.err
+}
+func (f failingAMQPChannel) Get(string, bool) (amqp.Delivery, bool, error) {
+	return amqp.Delivery{}, false, f.err
+}
+func (f failingAMQPChannel) Consume(string, string, bool, bool, bool, bool, amqp.Table) (<-chan amqp.Delivery, error) {
+	return nil, f.err
+}
+func (f failingAMQPChannel) Qos(int, int, bool) error                        { return f.err }
+func (f failingAMQPChannel) Cancel(string, bool) error                       { return f.err }
+func (f failingAMQPChannel) Confirm(bool) error                              { return f.err }
+func (f failingAMQPChannel) NotifyClose(c chan *amqp.Error) chan *amqp.Error { return c }
+func (f failingAMQPChannel) NotifyCancel(c chan string) chan string          { return c }
+
+func TestAMQPChannelWrapper_MarksPreconditionFailed(t *testing.T) {
+	ch := WrapAMQPChannel(nil)
+	ch.(*amqpChannelWrapper).raw = failingAMQPChannel{err: &amqp.Error{Code: amqp.PreconditionFailed}}
+
+	calls := map[string]func() error{
+		"ExchangeDeclare": func() error { return ch.ExchangeDeclare("x", ExchangeTopic, true, false, false, false, nil) },
+		"ExchangeDelete":  func() error { return ch.ExchangeDelete("x", true, false) },
+		"ExchangeBind":    func() error { return ch.ExchangeBind("d", "k", "s", false, nil) },
+		"ExchangeUnbind":  func() error { return ch.ExchangeUnbind("d", "k", "s", false, nil) },
+		"QueueDeclare": func() error {
+			_, err := ch.QueueDeclare("q", true, false, false, false, nil)
+			return err
+		},
+		"QueueInspect": func() error {
+			_, err := ch.QueueInspect("q")
+			return err
+		},
+		"QueueBind":   func() error { return ch.QueueBind("q", "k", "x", false, nil) },
+		"QueueUnbind": func() error { return ch.QueueUnbind("q", "k", "x", nil) },
+		"QueuePurge": func() error {
+			_, err := ch.QueuePurge("q", false)
+			return err
+		},
+		"QueueDelete": func() error {
+			_, err := ch.QueueDelete("q", false, true, false)
+			return err
+		},
+		"Publish": func() error { return ch.Publish("x", "k", nil) },
+		"Get": func() error {
+			_, _, err := ch.Get("q", false)
+			return err
+		},
+		"Consume": func() error {
+			_, err := ch.Consume("q", "c", false, false, false, false, nil)
+			return err
+		},
+		"Qos":     func() error { return ch.Qos(1, 0, false) },
+		"Cancel":  func() error { return ch.Cancel("c", false) },
+		"Confirm": func() error { return ch.Confirm(false) },
+	}
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			err := call()
+			require.ErrorIs(t, err, ErrPreconditionFailed)
+			var amqpErr *amqp.Error
+			require.ErrorAs(t, err, &amqpErr)
+		})
+	}
+}
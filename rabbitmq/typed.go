@@ -0,0 +1,68 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+)
+
+// TypedPublisher publishes values of type T encoded with a Codec.
+type TypedPublisher[T any] struct {
+	pub   *Publisher
+	codec Codec
+}
+
+// NewTypedPublisher returns a TypedPublisher that publishes through pub.
+func NewTypedPublisher[T any](pub *Publisher, codec Codec) *TypedPublisher[T] {
+	return &TypedPublisher[T]{pub: pub, codec: codec}
+}
+
+// Publish encodes v and publishes it with the codec's content type.
+func (p *TypedPublisher[T]) Publish(ctx context.Context, exchange, routingKey string, v T) error {
+	return p.PublishWithOptions(ctx, exchange, routingKey, v, Publishing{})
+}
+
+// PublishWithOptions encodes v and publishes it with the properties of msg.
+// The body and content type of msg are replaced.
+func (p *TypedPublisher[T]) PublishWithOptions(ctx context.Context, exchange, routingKey string, v T, msg Publishing) error {
+	body, err := p.codec.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("publisher: encode %T: %w", v, err)
+	}
+	msg.ContentType = p.codec.ContentType()
+	msg.Body = body
+	return p.pub.PublishWithContext(ctx, exchange, routingKey, false, false, msg)
+}
+
+// TypedHandlerFunc handles a decoded message. The raw delivery is passed for its metadata.
+type TypedHandlerFunc[T any] func(ctx context.Context, v T, d Delivery) error
+
+// TypedWorker is a Worker that decodes every message into a T before calling its handler.
+//
+// Messages that cannot be decoded never reach the handler: they are passed to
+// WorkerConfig.OnDecodeError and fail with a Permanent error wrapping ErrDecode,
+// so they are logged and rejected, or moved to the parking queue when
+// WorkerConfig.Retry is set.
+type TypedWorker[T any] struct {
+	*Worker
+}
+
+// NewTypedWorker returns a TypedWorker for the given configuration. The
+// Handler and ContextHandler fields of config are replaced by handler;
+// config.Middleware still applies.
+func NewTypedWorker[T any](channel Channel, config WorkerConfig, codec Codec, handler TypedHandlerFunc[T]) *TypedWorker[T] {
+	config.Handler = nil
+	config.ContextHandler = nil
+	if handler != nil {
+		config.ContextHandler = func(ctx context.Context, d Delivery) error {
+			v, err := decode[T](codec, d)
+			if err != nil {
+				if config.OnDecodeError != nil {
+					config.OnDecodeError(d, err)
+				}
+				return Permanent(err)
+			}
+			return handler(ctx, v, d)
+		}
+	}
+	return &TypedWorker[T]{Worker: NewWorker(channel, config)}
+}
@@ -0,0 +1,107 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type orderCreated struct {
+	ID    string `json:"id"`
+	Total int    `json:"total"`
+}
+
+func TestTypedPublisher_Publish(t *testing.T) {
+	mock := &mockChannel{}
+	pub := NewTypedPublisher[orderCreated](NewPublisher(mock), JSON)
+
+	err := pub.PublishWithOptions(context.Background(), "orders", "order.created", orderCreated{ID: "42", Total: 100}, Publishing{MessageID: "m-1"})
+	require.NoError(t, err)
+
+	require.Equal(t, "orders", mock.lastPublish.exchange)
+	require.Equal(t, JSONContentType, mock.lastPublish.msg.ContentType)
+	require.Equal(t, "m-1", mock.lastPublish.msg.MessageID)
+	require.JSONEq(t, `{"id":"42","total":100}`, string(mock.lastPublish.msg.Body))
+}
+
+func TestTypedPublisher_EncodeError(t *testing.T) {
+	mock := &mockChannel{}
+	pub := NewTypedPublisher[chan int](NewPublisher(mock), JSON)
+
+	require.Error(t, pub.Publish(context.Background(), "orders", "key", make(chan int)))
+	require.False(t, mock.published)
+}
+
+func TestTypedWorker_DecodesAndRejectsPoisonMessages(t *testing.T) {
+	messages := make(chan Delivery, 4)
+	messages <- Delivery{DeliveryTag: 1, ContentType: JSONContentType, Body: []byte(`{"id":"42","total":100}`)}
+	messages <- Delivery{DeliveryTag: 2, ContentType: JSONContentType, Body: []byte(`not json`)}
+	messages <- Delivery{DeliveryTag: 3, ContentType: "text/plain", Body: []byte(`{"id":"43"}`)}
+	messages <- Delivery{DeliveryTag: 4, ContentType: "application/json; charset=utf-8", Body: []byte(`{"id":"44"}`)}
+	close(messages)
+
+	mock := &mockChannel{messages: messages}
+	var handled []orderCreated
+	var poison []uint64
+	config := WorkerConfig{
+		Queue:   "orders",
+		OnError: func(error) {},
+		OnDecodeError: func(d Delivery, err error) {
+			require.ErrorIs(t, err, ErrDecode)
+			poison = append(poison, d.DeliveryTag)
+		},
+	}
+	worker := NewTypedWorker(mock, config, JSON,
+		func(ctx context.Context, v orderCreated, d Delivery) error {
+			handled = append(handled, v)
+			return nil
+		})
+
+	require.NoError(t, worker.Start(context.Background()))
+	worker.Wait()
+
+	require.Equal(t, []orderCreated{{ID: "42", Total: 100}, {ID: "44"}}, handled)
+	require.Equal(t, []uint64{1, 4}, mock.acked)
+	require.Equal(t, []uint64{2, 3}, mock.rejected)
+	require.Equal(t, []uint64{2, 3}, poison)
+}
+
+func TestDecode(t *testing.T) {
+	_, err := decode[orderCreated](JSON, Delivery{ContentType: "text/plain"})
+	require.ErrorIs(t, err, ErrDecode)
+
+	_, err = decode[orderCreated](JSON, Delivery{ContentType: "application/json-seq", Body: []byte(`{}`)})
+	require.ErrorIs(t, err, ErrDecode)
+
+	v, err := decode[orderCreated](JSON, Delivery{Body: []byte(`{"id":"1"}`)})
+	require.NoError(t, err)
+	require.Equal(t, "1", v.ID)
+
+	v, err = decode[orderCreated](JSON, Delivery{ContentType: "Application/JSON; charset=utf-8", Body: []byte(`{"id":"2"}`)})
+	require.NoError(t, err)
+	require.Equal(t, "2", v.ID)
+}
+
+func TestNewCodec(t *testing.T) {
+	codec := NewCodec("text/plain",
+		func(v interface{}) ([]byte, error) { return []byte(*v.(*string)), nil },
+		func(data []byte, v interface{}) error {
+			if len(data) == 0 {
+				return errors.New("empty")
+			}
+			*v.(*string) = strings.ToUpper(string(data))
+			return nil
+		})
+
+	s := "hello"
+	body, err := codec.Marshal(&s)
+	require.NoError(t, err)
+	require.Equal(t, "text/plain", codec.ContentType())
+
+	got, err := decode[string](codec, Delivery{ContentType: "text/plain", Body: body})
+	require.NoError(t, err)
+	require.Equal(t, "HELLO", got)
+}
@@ -4,35 +4,120 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"sync"
-	"log"
 	"time"
 )
 
+// ErrConsumerClosed is reported when the delivery channel closes while the worker is running,
+// for example because the broker cancelled the consumer or the channel was closed.
+var ErrConsumerClosed = errors.New("worker: consumer closed unexpectedly")
+
 // HandlerFunc defines a function to process incoming messages.
+//
+// When AutoAck is disabled the Worker settles each message from the returned error:
+// nil acks it, an error wrapped with Requeue nacks it back onto the queue, an error
+// wrapped with Permanent rejects it, and any other error nacks it without requeueing.
+// With WorkerConfig.Retry set, failed messages are retried instead; see RetryConfig.
 type HandlerFunc func(Delivery) error
 
+// ContextHandlerFunc is a HandlerFunc that receives a per-message context. The
+// context carries the values of the one passed to Worker.Start and the
+// delivery (see DeliveryFromContext). It is not cancelled with the Start
+// context, so running handlers can finish during a shutdown; it is cancelled
+// after HandlerTimeout, or when the shutdown gives up on the handler at
+// ShutdownTimeout. Its error settles the message like HandlerFunc's.
+type ContextHandlerFunc func(ctx context.Context, d Delivery) error
+
+// AdaptHandler turns a HandlerFunc into a ContextHandlerFunc that ignores the context.
+func AdaptHandler(h HandlerFunc) ContextHandlerFunc {
+	return func(_ context.Context, d Delivery) error { return h(d) }
+}
+
+// Middleware wraps a ContextHandlerFunc with cross-cutting behaviour such as
+// logging or panic recovery. See the middleware package for built-in ones.
+type Middleware func(next ContextHandlerFunc) ContextHandlerFunc
+
+// Chain applies middlewares to h so that the first one is the outermost.
+func Chain(h ContextHandlerFunc, middlewares ...Middleware) ContextHandlerFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
 // WorkerConfig holds configuration for a Worker.
 type WorkerConfig struct {
-	Queue       string
+	Queue string
+	// ConsumerTag identifies the consumer so the worker can cancel it. A
+	// unique tag is generated when empty.
 	ConsumerTag string
 	AutoAck     bool
 	Handler     HandlerFunc
 
+	// ContextHandler is used instead of Handler when set.
+	ContextHandler ContextHandlerFunc
+	// HandlerTimeout bounds each ContextHandler call through its context. Zero means no timeout.
+	HandlerTimeout time.Duration
+	// Middleware wraps the handler, the first entry being the outermost.
+	Middleware []Middleware
+
+	// Concurrency is the number of messages handled in parallel, at least one.
+	Concurrency int
+	// Prefetch limits the unacknowledged messages the broker delivers to the
+	// consumer. Zero leaves the channel's QoS unchanged.
+	Prefetch int
+
 	// automatically declare & bind queue before consuming
 	Declare        bool
 	BindRoutingKey string
 	BindExchange   string
+
+	// Resubscribe restarts consuming after ErrConsumerClosed, waiting Backoff between
+	// attempts, until the context passed to Start is cancelled.
+	Resubscribe bool
+	Backoff     Backoff
+
+	// Retry republishes failed messages to delay queues instead of dropping
+	// them, declaring the retry topology before consuming. See RetryConfig.
+	Retry *RetryConfig
+
+	// ShutdownTimeout bounds how long the worker drains once shutdown begins.
+	// Defaults to DefaultShutdownTimeout.
+	ShutdownTimeout time.Duration
+
+	// OnError is called with ErrConsumerClosed and with every failed resubscribe
+	// attempt. Errors are logged when it is nil.
+	OnError func(err error)
+
+	// OnDecodeError is called by TypedWorker with every message it cannot
+	// decode, before the message is rejected or parked.
+	OnDecodeError func(d Delivery, err error)
+
+	// Logger receives the worker's log events, with the queue and consumer tag
+	// attached. Defaults to slog.Default().
+	Logger *slog.Logger
 }
 
 // Worker represents a consumer of messages from a queue.
 type Worker struct {
 	config  WorkerConfig
 	channel Channel
+	handler ContextHandlerFunc
+	logger  *slog.Logger
 	wg      sync.WaitGroup
+
+	stopOnce    sync.Once
+	stop        chan struct{}      // closed when shutdown begins
+	drainCtx    context.Context    // bounds the shutdown, set before stop is closed
+	drainCancel context.CancelFunc // ends the drain early, set with drainCtx
+
+	resultMu sync.Mutex
+	result   error // outcome of the drain
 }
 
-// DeclareAndBind declares and binds the queue with given parameters.
+// DeclareAndBind declares a durable queue and binds it with given parameters.
+// Use Topology for anything more involved.
 func DeclareAndBind(channel Channel, queue, key, exchange string) error {
 	_, err := channel.QueueDeclare(queue, true, false, false, false, nil)
 	if err != nil {
@@ -43,26 +128,66 @@ func DeclareAndBind(channel Channel, queue, key, exchange string) error {
 
 // NewWorker creates a new Worker with the given Channel and configuration.
 func NewWorker(channel Channel, config WorkerConfig) *Worker {
+	handler := config.ContextHandler
+	if handler == nil && config.Handler != nil {
+		handler = AdaptHandler(config.Handler)
+	}
+	if handler != nil {
+		handler = Chain(handler, config.Middleware...)
+	}
+	if config.ConsumerTag == "" {
+		config.ConsumerTag = fmt.Sprintf("worker-%s-%d", config.Queue, consumerSeq.Add(1))
+	}
+	logger := config.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
 	return &Worker{
 		config:  config,
 		channel: channel,
+		handler: handler,
+		logger:  logger.With(slog.String("queue", config.Queue), slog.String("consumer_tag", config.ConsumerTag)),
+		stop:    make(chan struct{}),
 	}
 }
 
 // Start begins consuming messages from the configured queue.
 func (w *Worker) Start(ctx context.Context) error {
-	if w.config.Handler == nil {
+	if w.handler == nil {
 		return errors.New("worker: HandlerFunc must be set")
 	}
 
-	// Optional queue declare & bind
+	msgs, err := w.subscribe()
+	if err != nil {
+		return err
+	}
+
+	w.wg.Add(1)
+	go w.run(ctx, msgs)
+
+	return nil
+}
+
+// subscribe declares and binds the queue when configured and starts consuming it.
+func (w *Worker) subscribe() (<-chan Delivery, error) {
 	if w.config.Declare {
 		if err := DeclareAndBind(w.channel, w.config.Queue, w.config.BindRoutingKey, w.config.BindExchange); err != nil {
-			return fmt.Errorf("worker: declare and bind failed: %w", err)
+			return nil, fmt.Errorf("worker: declare and bind failed: %w", err)
+		}
+	}
+
+	if w.config.Retry != nil {
+		if err := DeclareRetryTopology(w.channel, w.config.Queue, *w.config.Retry); err != nil {
+			return nil, fmt.Errorf("worker: %w", err)
+		}
+	}
+
+	if w.config.Prefetch > 0 {
+		if err := w.channel.Qos(w.config.Prefetch, 0, false); err != nil {
+			return nil, fmt.Errorf("worker: set prefetch failed: %w", err)
 		}
 	}
 
-	// Start consuming
 	msgs, err := w.channel.Consume(
 		w.config.Queue,
 		w.config.ConsumerTag,
@@ -70,31 +195,140 @@ func (w *Worker) Start(ctx context.Context) error {
 		false, false, false, nil,
 	)
 	if err != nil {
-		return fmt.Errorf("worker: failed to consume: %w", err)
+		return nil, fmt.Errorf("worker: failed to consume: %w", err)
 	}
+	return msgs, nil
+}
 
-	w.wg.Add(1)
+// run processes msgs and, when Resubscribe is set, consumes again every time
+// the delivery channel closes before ctx is done. Cancelling ctx starts a
+// shutdown like Shutdown does.
+func (w *Worker) run(ctx context.Context, msgs <-chan Delivery) {
+	defer w.wg.Done()
+
+	exited := make(chan struct{})
+	defer close(exited)
 	go func() {
-		defer w.wg.Done()
-		for {
+		select {
+		case <-ctx.Done():
+			w.beginShutdown(context.Background())
+		case <-exited:
+		}
+	}()
+
+	for {
+		if !w.consume(ctx, msgs) {
+			return
+		}
+		w.report("consumer closed unexpectedly", ErrConsumerClosed)
+		if !w.config.Resubscribe {
+			return
+		}
+		if msgs = w.resubscribe(); msgs == nil {
+			return
+		}
+	}
+}
+
+// consume handles messages on up to Concurrency goroutines until shutdown
+// begins or msgs closes. It reports whether msgs closed while the worker was
+// still running.
+func (w *Worker) consume(ctx context.Context, msgs <-chan Delivery) bool {
+	pool := newHandlerPool(ctx, max(w.config.Concurrency, 1))
+	defer pool.cancel()
+	for {
+		select {
+		case <-w.stop:
+			w.setResult(w.drain(msgs, nil, pool))
+			return false
+		case msg, ok := <-msgs:
+			if !ok {
+				pool.wait(nil)
+				return ctx.Err() == nil && !w.stopping()
+			}
 			select {
-			case <-ctx.Done():
-				log.Println("👷 canceling consumer", w.config.ConsumerTag)
-				_ = w.channel.Cancel(w.config.ConsumerTag, false)
-				time.Sleep(200 * time.Millisecond)
-				return
-			case msg, ok := <-msgs:
-				if !ok {
-					return
-				}
-				if err := w.config.Handler(msg); err != nil {
-					fmt.Printf("worker: handler error: %v\n", err)
-				}
+			case pool.slots <- struct{}{}:
+				pool.run(msg, w.handle)
+			case <-w.stop:
+				w.setResult(w.drain(msgs, &msg, pool))
+				return false
 			}
 		}
-	}()
+	}
+}
 
-	return nil
+// resubscribe retries subscribe with backoff. It returns nil once shutdown begins.
+func (w *Worker) resubscribe() <-chan Delivery {
+	for attempt := 1; ; attempt++ {
+		if !sleep(w.config.Backoff.Duration(attempt), w.stop) {
+			return nil
+		}
+		msgs, err := w.subscribe()
+		if err == nil {
+			return msgs
+		}
+		w.report("resubscribe failed", fmt.Errorf("worker: resubscribe attempt %d: %w", attempt, err), slog.Int("attempt", attempt))
+	}
+}
+
+// report passes err to OnError, or logs it with msg when OnError is not set.
+func (w *Worker) report(msg string, err error, attrs ...slog.Attr) {
+	if w.config.OnError != nil {
+		w.config.OnError(err)
+		return
+	}
+	w.logger.LogAttrs(context.Background(), slog.LevelError, msg, append(attrs, slog.Any("error", err))...)
+}
+
+// logDelivery logs msg about d with its routing attributes and err.
+func (w *Worker) logDelivery(ctx context.Context, msg string, d Delivery, err error) {
+	w.logger.LogAttrs(ctx, slog.LevelError, msg,
+		slog.String("exchange", d.Exchange),
+		slog.String("routing_key", d.RoutingKey),
+		slog.Uint64("delivery_tag", d.DeliveryTag),
+		slog.Any("error", err),
+	)
+}
+
+// handle runs the handler and settles the message when AutoAck is disabled.
+func (w *Worker) handle(ctx context.Context, msg Delivery) {
+	ctx = ContextWithDelivery(ctx, msg)
+	if w.config.HandlerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.config.HandlerTimeout)
+		defer cancel()
+	}
+
+	err := w.handler(ctx, msg)
+	if err != nil {
+		w.logDelivery(ctx, "message handler failed", msg, err)
+	}
+	if w.config.Retry != nil && err != nil && !IsRequeue(err) {
+		if err := w.retry(msg, err); err != nil {
+			w.logDelivery(ctx, "retry failed", msg, err)
+		}
+		return
+	}
+	if w.config.AutoAck {
+		return
+	}
+	if err := settle(msg, err); err != nil {
+		w.logDelivery(ctx, "settle failed", msg, err)
+	}
+}
+
+// settle acknowledges msg according to the handler result.
+func settle(msg Delivery, handlerErr error) error {
+	switch {
+	case handlerErr == nil:
+		return msg.Ack()
+	case IsPermanent(handlerErr):
+		return msg.Reject(false)
+	case IsRequeue(handlerErr):
+		return msg.Nack(true)
+	default:
+		return msg.Nack(false)
+	}
 }
 
 // Wait blocks until the worker has stopped processing.
@@ -1,9 +1,15 @@
 package rabbitmq
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -122,3 +128,535 @@ func TestWorker_Start_Declare_Success(t *testing.T) {
 	// assert: сообщение обработано
 	require.True(t, handled, "handler should have been called")
 }
+
+func TestWorker_ManualAckSettlesByHandlerResult(t *testing.T) {
+	messages := make(chan Delivery, 4)
+	messages <- Delivery{DeliveryTag: 1, Body: []byte("ok")}
+	messages <- Delivery{DeliveryTag: 2, Body: []byte("retry")}
+	messages <- Delivery{DeliveryTag: 3, Body: []byte("poison")}
+	messages <- Delivery{DeliveryTag: 4, Body: []byte("failed")}
+	close(messages)
+
+	mock := &mockChannel{messages: messages}
+
+	worker := NewWorker(mock, WorkerConfig{
+		Queue:       "test_queue",
+		ConsumerTag: "test_consumer",
+		AutoAck:     false,
+		Handler: func(d Delivery) error {
+			switch string(d.Body) {
+			case "retry":
+				return Requeue(errors.New("temporary failure"))
+			case "poison":
+				return Permanent(errors.New("cannot decode"))
+			case "failed":
+				return errors.New("unexpected failure")
+			}
+			return nil
+		},
+	})
+
+	err := worker.Start(context.Background())
+	require.NoError(t, err)
+
+	worker.Wait()
+
+	require.Equal(t, []uint64{1}, mock.acked)
+	require.Equal(t, []uint64{2, 4}, mock.nacked)
+	require.Equal(t, []uint64{2}, mock.requeued)
+	require.Equal(t, []uint64{3}, mock.rejected)
+}
+
+func TestWorker_AutoAckDoesNotSettle(t *testing.T) {
+	messages := make(chan Delivery, 1)
+	messages <- Delivery{DeliveryTag: 1, Body: []byte("ok")}
+	close(messages)
+
+	mock := &mockChannel{messages: messages}
+
+	worker := NewWorker(mock, WorkerConfig{
+		Queue:       "test_queue",
+		ConsumerTag: "test_consumer",
+		AutoAck:     true,
+		Handler:     func(d Delivery) error { return errors.New("ignored") },
+	})
+
+	err := worker.Start(context.Background())
+	require.NoError(t, err)
+
+	worker.Wait()
+
+	require.Empty(t, mock.acked)
+	require.Empty(t, mock.nacked)
+	require.Empty(t, mock.rejected)
+}
+
+func TestWorker_ConcurrencyAndPrefetch(t *testing.T) {
+	messages := make(chan Delivery, 3)
+	for i := 1; i <= 3; i++ {
+		messages <- Delivery{Body: []byte(fmt.Sprintf("msg-%d", i))}
+	}
+	close(messages)
+
+	mock := &mockChannel{messages: messages}
+
+	var running sync.WaitGroup
+	running.Add(3)
+	worker := NewWorker(mock, WorkerConfig{
+		Queue:       "test_queue",
+		ConsumerTag: "test_consumer",
+		Concurrency: 3,
+		Prefetch:    6,
+		Handler: func(d Delivery) error {
+			// Every handler waits for the others, so this only finishes
+			// when all three messages are handled in parallel.
+			running.Done()
+			running.Wait()
+			return nil
+		},
+	})
+
+	require.NoError(t, worker.Start(context.Background()))
+	worker.Wait()
+
+	require.Equal(t, 6, mock.prefetchCount)
+	require.False(t, mock.qosGlobal)
+	require.ElementsMatch(t, []uint64{1, 2, 3}, mock.acked)
+}
+
+// resubscribeChannel hands out a new delivery channel, or an error, on every Consume.
+type resubscribeChannel struct {
+	*mockChannel
+	mu       sync.Mutex
+	consumes []func() (<-chan Delivery, error)
+	declared int
+}
+
+func (r *resubscribeChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args Table) (Queue, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.declared++
+	return Queue{Name: name}, nil
+}
+
+func (r *resubscribeChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args Table) (<-chan Delivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	next := r.consumes[0]
+	if len(r.consumes) > 1 {
+		r.consumes = r.consumes[1:]
+	}
+	return next()
+}
+
+func TestWorker_ResubscribesAfterConsumerClosed(t *testing.T) {
+	first := make(chan Delivery, 1)
+	first <- Delivery{Body: []byte("one")}
+	close(first)
+	second := make(chan Delivery, 1)
+	second <- Delivery{Body: []byte("two")}
+
+	ch := &resubscribeChannel{
+		mockChannel: &mockChannel{},
+		consumes: []func() (<-chan Delivery, error){
+			func() (<-chan Delivery, error) { return first, nil },
+			func() (<-chan Delivery, error) { return nil, errors.New("queue not found") },
+			func() (<-chan Delivery, error) { return second, nil },
+		},
+	}
+
+	var mu sync.Mutex
+	var reported []error
+	handled := make(chan string, 2)
+
+	worker := NewWorker(ch, WorkerConfig{
+		Queue:       "test_queue",
+		ConsumerTag: "test_consumer",
+		AutoAck:     true,
+		Declare:     true,
+		Resubscribe: true,
+		Backoff:     Backoff{Min: time.Millisecond, Max: time.Millisecond},
+		// The stub never closes its delivery channel on Cancel.
+		ShutdownTimeout: 10 * time.Millisecond,
+		OnError: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			reported = append(reported, err)
+		},
+		Handler: func(d Delivery) error {
+			handled <- string(d.Body)
+			return nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, worker.Start(ctx))
+
+	require.Equal(t, "one", <-handled)
+	require.Equal(t, "two", <-handled)
+	cancel()
+	worker.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, reported, 2)
+	require.ErrorIs(t, reported[0], ErrConsumerClosed)
+	require.ErrorContains(t, reported[1], "queue not found")
+	require.Equal(t, 3, ch.declared)
+}
+
+func TestWorker_ReportsConsumerClosedWithoutResubscribe(t *testing.T) {
+	messages := make(chan Delivery)
+	close(messages)
+
+	var reported error
+	worker := NewWorker(&mockChannel{messages: messages}, WorkerConfig{
+		Queue:       "test_queue",
+		ConsumerTag: "test_consumer",
+		Handler:     func(d Delivery) error { return nil },
+		OnError:     func(err error) { reported = err },
+	})
+
+	require.NoError(t, worker.Start(context.Background()))
+	worker.Wait()
+
+	require.ErrorIs(t, reported, ErrConsumerClosed)
+}
+
+func TestErrorMarkers(t *testing.T) {
+	base := errors.New("boom")
+
+	require.Nil(t, Permanent(nil))
+	require.Nil(t, Requeue(nil))
+
+	require.True(t, IsPermanent(Permanent(base)))
+	require.False(t, IsRequeue(Permanent(base)))
+	require.True(t, IsRequeue(Requeue(base)))
+	require.ErrorIs(t, Requeue(base), base)
+	require.True(t, IsPermanent(fmt.Errorf("decode: %w", Permanent(base))))
+}
+
+// prefetchChannel hands out a buffer of already prefetched deliveries and
+// closes it on Cancel, like the broker does.
+type prefetchChannel struct {
+	*mockChannel
+	deliveries chan Delivery
+}
+
+func newPrefetchChannel(n int) *prefetchChannel {
+	ch := &prefetchChannel{mockChannel: &mockChannel{}, deliveries: make(chan Delivery, n)}
+	for tag := 1; tag <= n; tag++ {
+		ch.deliveries <- Delivery{Acknowledger: ch.mockChannel, DeliveryTag: uint64(tag)}
+	}
+	return ch
+}
+
+func (p *prefetchChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args Table) (<-chan Delivery, error) {
+	return p.deliveries, nil
+}
+
+func (p *prefetchChannel) Cancel(consumer string, noWait bool) error {
+	close(p.deliveries)
+	return p.mockChannel.Cancel(consumer, noWait)
+}
+
+func TestWorker_ShutdownRequeuesPrefetched(t *testing.T) {
+	ch := newPrefetchChannel(3)
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	worker := NewWorker(ch, WorkerConfig{
+		Queue:       "test_queue",
+		ConsumerTag: "test_consumer",
+		Handler: func(d Delivery) error {
+			close(started)
+			<-release
+			return nil
+		},
+	})
+	require.NoError(t, worker.Start(context.Background()))
+	<-started
+
+	result := make(chan error)
+	go func() { result <- worker.Shutdown(context.Background()) }()
+
+	require.Eventually(t, func() bool {
+		ch.mu.Lock()
+		defer ch.mu.Unlock()
+		return len(ch.requeued) == 2
+	}, time.Second, time.Millisecond)
+	close(release)
+
+	var shutdownErr *ShutdownError
+	require.ErrorAs(t, <-result, &shutdownErr)
+	require.Equal(t, []uint64{2, 3}, shutdownErr.Requeued)
+	require.Empty(t, shutdownErr.Abandoned)
+	require.NoError(t, shutdownErr.Err)
+	require.True(t, ch.CancelCalled)
+	require.Equal(t, []uint64{1}, ch.acked)
+}
+
+func TestWorker_ShutdownDeadlineAbandonsHandlers(t *testing.T) {
+	ch := newPrefetchChannel(1)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	worker := NewWorker(ch, WorkerConfig{
+		Queue:           "test_queue",
+		ConsumerTag:     "test_consumer",
+		ShutdownTimeout: 20 * time.Millisecond,
+		Handler: func(d Delivery) error {
+			close(started)
+			<-release
+			return nil
+		},
+	})
+	require.NoError(t, worker.Start(context.Background()))
+	<-started
+
+	err := worker.Shutdown(context.Background())
+	require.ErrorIs(t, err, ErrShutdownTimeout)
+
+	var shutdownErr *ShutdownError
+	require.ErrorAs(t, err, &shutdownErr)
+	require.Equal(t, []uint64{1}, shutdownErr.Abandoned)
+	require.Empty(t, shutdownErr.Requeued)
+}
+
+func TestWorker_ShutdownWhenIdle(t *testing.T) {
+	worker := NewWorker(newPrefetchChannel(0), WorkerConfig{
+		Queue:       "test_queue",
+		ConsumerTag: "test_consumer",
+		Handler:     func(d Delivery) error { return nil },
+	})
+	require.NoError(t, worker.Start(context.Background()))
+
+	require.NoError(t, worker.Shutdown(context.Background()))
+}
+
+func TestWorker_ContextHandler(t *testing.T) {
+	messages := make(chan Delivery, 1)
+	messages <- Delivery{MessageID: "msg-1", Body: []byte("hello")}
+	close(messages)
+
+	type traceKey struct{}
+	ctx := context.WithValue(context.Background(), traceKey{}, "trace-1")
+
+	mock := &mockChannel{messages: messages}
+
+	var trace interface{}
+	var hasDeadline, ok bool
+	var fromCtx Delivery
+	worker := NewWorker(mock, WorkerConfig{
+		Queue:          "test_queue",
+		ConsumerTag:    "test_consumer",
+		HandlerTimeout: time.Minute,
+		ContextHandler: func(ctx context.Context, d Delivery) error {
+			trace = ctx.Value(traceKey{})
+			_, hasDeadline = ctx.Deadline()
+			fromCtx, ok = DeliveryFromContext(ctx)
+			return Permanent(errors.New("rejected"))
+		},
+	})
+
+	require.NoError(t, worker.Start(ctx))
+	worker.Wait()
+
+	require.Equal(t, "trace-1", trace)
+	require.True(t, hasDeadline)
+	require.True(t, ok)
+	require.Equal(t, "msg-1", fromCtx.MessageID)
+	require.Equal(t, []uint64{1}, mock.rejected)
+}
+
+func TestWorker_ContextHandlerSeesCancellation(t *testing.T) {
+	messages := make(chan Delivery, 1)
+	messages <- Delivery{Body: []byte("slow")}
+	mock := &mockChannel{messages: messages}
+
+	started := make(chan struct{})
+	worker := NewWorker(mock, WorkerConfig{
+		Queue:           "test_queue",
+		ConsumerTag:     "test_consumer",
+		ShutdownTimeout: 20 * time.Millisecond,
+		ContextHandler: func(ctx context.Context, d Delivery) error {
+			close(started)
+			<-ctx.Done()
+			return Requeue(ctx.Err())
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, worker.Start(ctx))
+	<-started
+	cancel()
+	worker.Wait()
+
+	// The handler context is cancelled once the drain gives up on it, and the
+	// handler still settles the message afterwards.
+	require.Eventually(t, func() bool {
+		mock.mu.Lock()
+		defer mock.mu.Unlock()
+		return len(mock.requeued) == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestWorker_ContextHandlerFinishesDuringDrain(t *testing.T) {
+	messages := make(chan Delivery, 1)
+	messages <- Delivery{DeliveryTag: 1, Body: []byte("slow")}
+	mock := &mockChannel{messages: messages}
+
+	type key struct{}
+	started := make(chan struct{})
+	worker := NewWorker(mock, WorkerConfig{
+		Queue:           "test_queue",
+		ConsumerTag:     "test_consumer",
+		ShutdownTimeout: time.Second,
+		ContextHandler: func(ctx context.Context, d Delivery) error {
+			close(started)
+			select {
+			case <-ctx.Done():
+				return Requeue(ctx.Err())
+			case <-time.After(30 * time.Millisecond):
+			}
+			if ctx.Value(key{}) != "start" {
+				return errors.New("lost the Start context values")
+			}
+			return nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "start"))
+	require.NoError(t, worker.Start(ctx))
+	<-started
+	cancel()
+
+	require.NoError(t, worker.Shutdown(context.Background()))
+	require.Equal(t, []uint64{1}, mock.acked, "the handler ran to completion after the Start context was cancelled")
+	require.Empty(t, mock.requeued)
+}
+
+func TestWorker_ShutdownDeadlineEndsDrainStartedByCancel(t *testing.T) {
+	messages := make(chan Delivery, 1)
+	messages <- Delivery{DeliveryTag: 1, Body: []byte("stuck")}
+	mock := &mockChannel{messages: messages}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	worker := NewWorker(mock, WorkerConfig{
+		Queue:       "test_queue",
+		ConsumerTag: "test_consumer",
+		Handler: func(d Delivery) error {
+			close(started)
+			<-release
+			return nil
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, worker.Start(ctx))
+	<-started
+	cancel()
+
+	shutdownCtx, stop := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer stop()
+	begin := time.Now()
+	err := worker.Shutdown(shutdownCtx)
+	require.Less(t, time.Since(begin), time.Second, "the drain honoured the Shutdown deadline, not DefaultShutdownTimeout")
+
+	var shutdownErr *ShutdownError
+	require.ErrorAs(t, err, &shutdownErr)
+	require.ErrorIs(t, err, ErrShutdownTimeout)
+	require.Equal(t, []uint64{1}, shutdownErr.Abandoned)
+}
+
+func TestAdaptHandler(t *testing.T) {
+	var got Delivery
+	handler := AdaptHandler(func(d Delivery) error {
+		got = d
+		return nil
+	})
+
+	require.NoError(t, handler(context.Background(), Delivery{Body: []byte("x")}))
+	require.Equal(t, []byte("x"), got.Body)
+}
+
+func TestChain_AppliesMiddlewareOutermostFirst(t *testing.T) {
+	var calls []string
+	trace := func(name string) Middleware {
+		return func(next ContextHandlerFunc) ContextHandlerFunc {
+			return func(ctx context.Context, d Delivery) error {
+				calls = append(calls, name)
+				return next(ctx, d)
+			}
+		}
+	}
+
+	messages := make(chan Delivery, 1)
+	messages <- Delivery{Body: []byte("x")}
+	close(messages)
+
+	worker := NewWorker(&mockChannel{messages: messages}, WorkerConfig{
+		Queue:      "test_queue",
+		Middleware: []Middleware{trace("first"), trace("second")},
+		Handler: func(d Delivery) error {
+			calls = append(calls, "handler")
+			return nil
+		},
+		OnError: func(error) {},
+	})
+	require.NoError(t, worker.Start(context.Background()))
+	worker.Wait()
+
+	require.Equal(t, []string{"first", "second", "handler"}, calls)
+}
+
+func TestWorker_GeneratesConsumerTag(t *testing.T) {
+	mock := &mockChannel{messages: make(chan Delivery)}
+	close(mock.messages)
+
+	worker := NewWorker(mock, WorkerConfig{Queue: "orders", Handler: func(Delivery) error { return nil }})
+	other := NewWorker(mock, WorkerConfig{Queue: "orders", Handler: func(Delivery) error { return nil }})
+	require.NotEmpty(t, worker.config.ConsumerTag)
+	require.NotEqual(t, worker.config.ConsumerTag, other.config.ConsumerTag)
+}
+
+func TestWorker_LogsStructuredEvents(t *testing.T) {
+	messages := make(chan Delivery, 1)
+	messages <- Delivery{DeliveryTag: 7, Exchange: "events", RoutingKey: "order.created"}
+	close(messages)
+
+	var buf bytes.Buffer
+	worker := NewWorker(&mockChannel{messages: messages}, WorkerConfig{
+		Queue:       "orders",
+		ConsumerTag: "orders-1",
+		Handler:     func(Delivery) error { return errors.New("bad payload") },
+		Logger:      slog.New(slog.NewJSONHandler(&buf, nil)),
+	})
+	require.NoError(t, worker.Start(context.Background()))
+	worker.Wait()
+
+	var records []map[string]interface{}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var r map[string]interface{}
+		require.NoError(t, dec.Decode(&r))
+		records = append(records, r)
+	}
+	require.Len(t, records, 2)
+
+	require.Equal(t, "message handler failed", records[0]["msg"])
+	require.Equal(t, "ERROR", records[0]["level"])
+	require.Equal(t, "orders", records[0]["queue"])
+	require.Equal(t, "orders-1", records[0]["consumer_tag"])
+	require.Equal(t, "events", records[0]["exchange"])
+	require.Equal(t, "order.created", records[0]["routing_key"])
+	require.Equal(t, float64(7), records[0]["delivery_tag"])
+	require.Equal(t, "bad payload", records[0]["error"])
+
+	require.Equal(t, "consumer closed unexpectedly", records[1]["msg"])
+	require.Equal(t, "orders", records[1]["queue"])
+	require.Equal(t, ErrConsumerClosed.Error(), records[1]["error"])
+}
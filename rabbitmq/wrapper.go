@@ -1,70 +1,306 @@
 package rabbitmq
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
 	"github.com/streadway/amqp"
 )
 
+// amqpChannel is the part of *amqp.Channel the wrapper uses.
+type amqpChannel interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	ExchangeDelete(name string, ifUnused, noWait bool) error
+	ExchangeBind(destination, key, source string, noWait bool, args amqp.Table) error
+	ExchangeUnbind(destination, key, source string, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueInspect(name string) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	QueueUnbind(name, key, exchange string, args amqp.Table) error
+	QueuePurge(name string, noWait bool) (int, error)
+	QueueDelete(name string, ifUnused, ifEmpty, noWait bool) (int, error)
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Get(queue string, autoAck bool) (amqp.Delivery, bool, error)
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Cancel(consumer string, noWait bool) error
+	Confirm(noWait bool) error
+	NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation
+	NotifyReturn(c chan amqp.Return) chan amqp.Return
+	NotifyClose(c chan *amqp.Error) chan *amqp.Error
+	NotifyCancel(c chan string) chan string
+	Close() error
+}
+
 // amqpChannelWrapper wraps *amqp.Channel to implement Channel.
 type amqpChannelWrapper struct {
-	raw *amqp.Channel
+	raw    amqpChannel
+	logger *slog.Logger
+
+	mu   sync.Mutex
+	lost error // reason the channel closed abnormally, if it did
+
+	forwardOnce sync.Once
+	notifyMu    sync.Mutex
+	confirms    []chan Confirmation
+	returns     []chan Return
+	notifyDone  bool // the channel closed and every listener was closed
+
+	cancelOnce sync.Once                // starts watchCancels
+	consumers  map[string]chan struct{} // closed to stop forwarding to a consumer, guarded by mu
+}
+
+// ChannelOption configures a wrapped channel.
+type ChannelOption func(*amqpChannelWrapper)
+
+// WithChannelLogger sets the logger of a wrapped channel. Defaults to slog.Default().
+func WithChannelLogger(logger *slog.Logger) ChannelOption {
+	return func(a *amqpChannelWrapper) {
+		if logger != nil {
+			a.logger = logger
+		}
+	}
 }
 
 // WrapAMQPChannel wraps a raw amqp.Channel into Channel.
-func WrapAMQPChannel(ch *amqp.Channel) Channel {
-	return &amqpChannelWrapper{raw: ch}
+func WrapAMQPChannel(ch *amqp.Channel, opts ...ChannelOption) Channel {
+	a := &amqpChannelWrapper{raw: ch, logger: slog.Default()}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
 }
 
 func (a *amqpChannelWrapper) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args Table) error {
-	return a.raw.ExchangeDeclare(name, kind, durable, autoDelete, internal, noWait, tableToAMQP(args))
+	return errorFromAMQP(a.raw.ExchangeDeclare(name, kind, durable, autoDelete, internal, noWait, tableToAMQP(args)))
+}
+
+func (a *amqpChannelWrapper) ExchangeDelete(name string, ifUnused, noWait bool) error {
+	return errorFromAMQP(a.raw.ExchangeDelete(name, ifUnused, noWait))
 }
 
 func (a *amqpChannelWrapper) Publish(exchange, routingKey string, body []byte) error {
-	return a.raw.Publish(exchange, routingKey, false, false, amqp.Publishing{
+	return a.PublishWithOptions(exchange, routingKey, false, false, Publishing{
 		ContentType: "application/octet-stream",
 		Body:        body,
 	})
 }
 
+func (a *amqpChannelWrapper) PublishWithOptions(exchange, routingKey string, mandatory, immediate bool, msg Publishing) error {
+	return errorFromAMQP(a.raw.Publish(exchange, routingKey, mandatory, immediate, publishingToAMQP(msg)))
+}
+
+func (a *amqpChannelWrapper) PublishWithContext(ctx context.Context, exchange, routingKey string, mandatory, immediate bool, msg Publishing) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.PublishWithOptions(exchange, routingKey, mandatory, immediate, msg)
+}
+
+func (a *amqpChannelWrapper) Confirm(noWait bool) error {
+	return errorFromAMQP(a.raw.Confirm(noWait))
+}
+
+// NotifyPublish forwards broker confirmations to confirm and closes it when the channel closes.
+func (a *amqpChannelWrapper) NotifyPublish(confirm chan Confirmation) chan Confirmation {
+	a.notifyMu.Lock()
+	defer a.notifyMu.Unlock()
+	if a.notifyDone {
+		close(confirm)
+		return confirm
+	}
+	a.confirms = append(a.confirms, confirm)
+	a.forwardOnce.Do(a.forwardNotifications)
+	return confirm
+}
+
+// NotifyReturn forwards returned messages to c and closes it when the channel closes.
+func (a *amqpChannelWrapper) NotifyReturn(c chan Return) chan Return {
+	a.notifyMu.Lock()
+	defer a.notifyMu.Unlock()
+	if a.notifyDone {
+		close(c)
+		return c
+	}
+	a.returns = append(a.returns, c)
+	a.forwardOnce.Do(a.forwardNotifications)
+	return c
+}
+
+// forwardNotifications forwards confirmations and returns on one goroutine.
+// amqp queues a basic.return before the basic.ack of the same publish, and
+// draining returns before each confirmation keeps that order for listeners.
+func (a *amqpChannelWrapper) forwardNotifications() {
+	rawConfirms := a.raw.NotifyPublish(make(chan amqp.Confirmation, DefaultMaxInFlight))
+	rawReturns := a.raw.NotifyReturn(make(chan amqp.Return, DefaultMaxInFlight))
+	go func() {
+		for rawConfirms != nil || rawReturns != nil {
+			select {
+			case c, ok := <-rawConfirms:
+				if !ok {
+					rawConfirms = nil
+					continue
+				}
+				rawReturns = a.drainReturns(rawReturns)
+				a.notifyMu.Lock()
+				for _, l := range a.confirms {
+					l <- Confirmation{DeliveryTag: c.DeliveryTag, Ack: c.Ack}
+				}
+				a.notifyMu.Unlock()
+			case r, ok := <-rawReturns:
+				if !ok {
+					rawReturns = nil
+					continue
+				}
+				a.sendReturn(r)
+			}
+		}
+
+		a.notifyMu.Lock()
+		defer a.notifyMu.Unlock()
+		a.notifyDone = true
+		for _, l := range a.confirms {
+			close(l)
+		}
+		for _, l := range a.returns {
+			close(l)
+		}
+		a.confirms, a.returns = nil, nil
+	}()
+}
+
+// drainReturns forwards every return already queued. It returns nil once returns is closed.
+func (a *amqpChannelWrapper) drainReturns(returns chan amqp.Return) chan amqp.Return {
+	for {
+		select {
+		case r, ok := <-returns:
+			if !ok {
+				return nil
+			}
+			a.sendReturn(r)
+		default:
+			return returns
+		}
+	}
+}
+
+func (a *amqpChannelWrapper) sendReturn(r amqp.Return) {
+	a.notifyMu.Lock()
+	defer a.notifyMu.Unlock()
+	for _, l := range a.returns {
+		l <- returnFromAMQP(r)
+	}
+}
+
 func (a *amqpChannelWrapper) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args Table) (Queue, error) {
 	q, err := a.raw.QueueDeclare(name, durable, autoDelete, exclusive, noWait, tableToAMQP(args))
 	if err != nil {
-		return Queue{}, err
+		return Queue{}, errorFromAMQP(err)
 	}
 	return Queue{Name: q.Name, Messages: q.Messages, Consumers: q.Consumers}, nil
 }
 
 func (a *amqpChannelWrapper) QueueBind(name, key, exchange string, noWait bool, args Table) error {
-	return a.raw.QueueBind(name, key, exchange, noWait, tableToAMQP(args))
+	return errorFromAMQP(a.raw.QueueBind(name, key, exchange, noWait, tableToAMQP(args)))
+}
+
+func (a *amqpChannelWrapper) QueueUnbind(name, key, exchange string, args Table) error {
+	return errorFromAMQP(a.raw.QueueUnbind(name, key, exchange, tableToAMQP(args)))
+}
+
+// QueueInspect passively declares the queue, failing when it does not exist.
+func (a *amqpChannelWrapper) QueueInspect(name string) (Queue, error) {
+	q, err := a.raw.QueueInspect(name)
+	if err != nil {
+		return Queue{}, errorFromAMQP(err)
+	}
+	return Queue{Name: q.Name, Messages: q.Messages, Consumers: q.Consumers}, nil
+}
+
+func (a *amqpChannelWrapper) QueueDelete(name string, ifUnused, ifEmpty, noWait bool) (int, error) {
+	n, err := a.raw.QueueDelete(name, ifUnused, ifEmpty, noWait)
+	return n, errorFromAMQP(err)
+}
+
+func (a *amqpChannelWrapper) ExchangeBind(destination, key, source string, noWait bool, args Table) error {
+	return errorFromAMQP(a.raw.ExchangeBind(destination, key, source, noWait, tableToAMQP(args)))
+}
+
+func (a *amqpChannelWrapper) ExchangeUnbind(destination, key, source string, noWait bool, args Table) error {
+	return errorFromAMQP(a.raw.ExchangeUnbind(destination, key, source, noWait, tableToAMQP(args)))
+}
+
+func (a *amqpChannelWrapper) QueuePurge(name string, noWait bool) (int, error) {
+	n, err := a.raw.QueuePurge(name, noWait)
+	return n, errorFromAMQP(err)
+}
+
+func (a *amqpChannelWrapper) Get(queue string, autoAck bool) (Delivery, bool, error) {
+	msg, ok, err := a.raw.Get(queue, autoAck)
+	if err != nil || !ok {
+		return Delivery{}, ok, errorFromAMQP(err)
+	}
+	return deliveryFromAMQP(msg), true, nil
+}
+
+func (a *amqpChannelWrapper) Qos(prefetchCount, prefetchSize int, global bool) error {
+	return errorFromAMQP(a.raw.Qos(prefetchCount, prefetchSize, global))
 }
 
 func (a *amqpChannelWrapper) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args Table) (<-chan Delivery, error) {
+	// A tag is needed to tell broker cancels of this consumer from others.
+	if consumer == "" {
+		consumer = fmt.Sprintf("xconnect-%d", consumerSeq.Add(1))
+	}
+	a.cancelOnce.Do(a.watchCancels)
+
+	// Register for close before consuming: on abnormal shutdown amqp sends the
+	// error here before it closes the delivery channel.
+	closeNotify := a.raw.NotifyClose(make(chan *amqp.Error, 1))
+	done := a.addConsumer(consumer)
+
 	rawChan, err := a.raw.Consume(queue, consumer, autoAck, exclusive, noLocal, noWait, tableToAMQP(args))
 	if err != nil {
-		return nil, err
+		a.stopConsumer(consumer)
+		return nil, errorFromAMQP(err)
 	}
 
 	wrappedChan := make(chan Delivery)
 	go func() {
 		defer close(wrappedChan)
 
-		cancelNotify := a.raw.NotifyCancel(make(chan string, 1))
-		closeNotify := a.raw.NotifyClose(make(chan *amqp.Error, 1))
-
 		for {
 			select {
 			case msg, ok := <-rawChan:
 				if !ok {
-					log.Println("🔚 rawChan closed")
-				return
+					select {
+					case e := <-closeNotify:
+						a.setCloseErr(e)
+					default:
+					}
+					attrs := []slog.Attr{slog.String("queue", queue), slog.String("consumer_tag", consumer)}
+					if err := a.closeErr(); err != nil {
+						a.logger.LogAttrs(context.Background(), slog.LevelWarn, "channel closed", append(attrs, slog.Any("error", err))...)
+					} else {
+						a.logger.LogAttrs(context.Background(), slog.LevelDebug, "delivery channel closed", attrs...)
+					}
+					return
 				}
-				wrappedChan <- Delivery{
-					Body:       msg.Body,
-					RoutingKey: msg.RoutingKey,
+				// Cancelling closes rawChan, but the caller may have stopped
+				// reading; the broker redelivers the message left behind.
+				select {
+				case wrappedChan <- deliveryFromAMQP(msg):
+				case <-done:
+					return
+				case e := <-closeNotify:
+					a.setCloseErr(e)
+					return
 				}
-			case <-cancelNotify:
-				return
-			case <-closeNotify:
+			case e := <-closeNotify:
+				a.setCloseErr(e)
 				return
 			}
 		}
@@ -73,17 +309,249 @@ func (a *amqpChannelWrapper) Consume(queue, consumer string, autoAck, exclusive,
 	return wrappedChan, nil
 }
 
+// watchCancels stops forwarding to consumers the broker cancels. It keeps
+// reading notifications until the channel closes, so amqp never blocks on it.
+func (a *amqpChannelWrapper) watchCancels() {
+	cancels := a.raw.NotifyCancel(make(chan string, 1))
+	go func() {
+		for tag := range cancels {
+			a.stopConsumer(tag)
+		}
+	}()
+}
+
+// addConsumer returns the channel that is closed when forwarding to consumer must stop.
+func (a *amqpChannelWrapper) addConsumer(consumer string) <-chan struct{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.consumers == nil {
+		a.consumers = make(map[string]chan struct{})
+	}
+	done := make(chan struct{})
+	a.consumers[consumer] = done
+	return done
+}
+
+func (a *amqpChannelWrapper) stopConsumer(consumer string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if done, ok := a.consumers[consumer]; ok {
+		close(done)
+		delete(a.consumers, consumer)
+	}
+}
+
 func (a *amqpChannelWrapper) Cancel(consumer string, noWait bool) error {
-	return a.raw.Cancel(consumer, noWait)
+	err := a.raw.Cancel(consumer, noWait)
+	a.stopConsumer(consumer)
+	return errorFromAMQP(err)
 }
 
 func (a *amqpChannelWrapper) Close() error {
 	return a.raw.Close()
 }
 
+// notifyClose returns a channel that receives the error of an abnormal close
+// and is closed once the underlying channel is closed.
+func (a *amqpChannelWrapper) notifyClose() <-chan error {
+	rawClose := a.raw.NotifyClose(make(chan *amqp.Error, 1))
+	out := make(chan error, 1)
+	go func() {
+		defer close(out)
+		for e := range rawClose {
+			if e != nil {
+				a.setCloseErr(e)
+				out <- e
+			}
+		}
+	}()
+	return out
+}
+
+// closeErr returns the reason the channel closed abnormally, or nil.
+func (a *amqpChannelWrapper) closeErr() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.lost
+}
+
+func (a *amqpChannelWrapper) setCloseErr(e *amqp.Error) {
+	if e == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.lost = e
+}
+
+// amqpConnector adapts *amqp.Connection for the Connection manager.
+type amqpConnector struct {
+	conn   *amqp.Connection
+	logger *slog.Logger
+}
+
+func dialAMQP(url string, logger *slog.Logger) (connector, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	return &amqpConnector{conn: conn, logger: logger}, nil
+}
+
+func (c *amqpConnector) channel() (Channel, error) {
+	ch, err := c.conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	return WrapAMQPChannel(ch, WithChannelLogger(c.logger)), nil
+}
+
+func (c *amqpConnector) notifyClose() <-chan error {
+	rawClose := c.conn.NotifyClose(make(chan *amqp.Error, 1))
+	out := make(chan error, 1)
+	go func() {
+		defer close(out)
+		for e := range rawClose {
+			if e != nil {
+				out <- e
+			}
+		}
+	}()
+	return out
+}
+
+func (c *amqpConnector) close() error {
+	return c.conn.Close()
+}
+
+// deliveryFromAMQP copies an amqp.Delivery into the xconnect Delivery type.
+func deliveryFromAMQP(msg amqp.Delivery) Delivery {
+	return Delivery{
+		Acknowledger:    msg.Acknowledger,
+		Headers:         tableFromAMQP(msg.Headers),
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationID:   msg.CorrelationId,
+		ReplyTo:         msg.ReplyTo,
+		Expiration:      msg.Expiration,
+		MessageID:       msg.MessageId,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		UserID:          msg.UserId,
+		AppID:           msg.AppId,
+		ConsumerTag:     msg.ConsumerTag,
+		DeliveryTag:     msg.DeliveryTag,
+		Redelivered:     msg.Redelivered,
+		Exchange:        msg.Exchange,
+		RoutingKey:      msg.RoutingKey,
+		MessageCount:    msg.MessageCount,
+		Body:            msg.Body,
+	}
+}
+
+// returnFromAMQP copies an amqp.Return into the xconnect Return type.
+func returnFromAMQP(r amqp.Return) Return {
+	return Return{
+		ReplyCode:       r.ReplyCode,
+		ReplyText:       r.ReplyText,
+		Exchange:        r.Exchange,
+		RoutingKey:      r.RoutingKey,
+		Headers:         tableFromAMQP(r.Headers),
+		ContentType:     r.ContentType,
+		ContentEncoding: r.ContentEncoding,
+		DeliveryMode:    r.DeliveryMode,
+		Priority:        r.Priority,
+		CorrelationID:   r.CorrelationId,
+		ReplyTo:         r.ReplyTo,
+		Expiration:      r.Expiration,
+		MessageID:       r.MessageId,
+		Timestamp:       r.Timestamp,
+		Type:            r.Type,
+		UserID:          r.UserId,
+		AppID:           r.AppId,
+		Body:            r.Body,
+	}
+}
+
+// publishingToAMQP copies a Publishing into the amqp.Publishing type.
+func publishingToAMQP(msg Publishing) amqp.Publishing {
+	return amqp.Publishing{
+		Headers:         tableToAMQP(msg.Headers),
+		ContentType:     msg.ContentType,
+		ContentEncoding: msg.ContentEncoding,
+		DeliveryMode:    msg.DeliveryMode,
+		Priority:        msg.Priority,
+		CorrelationId:   msg.CorrelationID,
+		ReplyTo:         msg.ReplyTo,
+		Expiration:      msg.Expiration,
+		MessageId:       msg.MessageID,
+		Timestamp:       msg.Timestamp,
+		Type:            msg.Type,
+		UserId:          msg.UserID,
+		AppId:           msg.AppID,
+		Body:            msg.Body,
+	}
+}
+
+// errorFromAMQP marks PRECONDITION_FAILED channel exceptions with
+// ErrPreconditionFailed, keeping the *amqp.Error in the chain.
+func errorFromAMQP(err error) error {
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.PreconditionFailed {
+		return fmt.Errorf("%w: %w", ErrPreconditionFailed, err)
+	}
+	return err
+}
+
 func tableToAMQP(t Table) amqp.Table {
 	if t == nil {
 		return nil
 	}
-	return amqp.Table(t)
+	out := make(amqp.Table, len(t))
+	for k, v := range t {
+		out[k] = valueToAMQP(v)
+	}
+	return out
+}
+
+func valueToAMQP(v interface{}) interface{} {
+	switch val := v.(type) {
+	case Table:
+		return tableToAMQP(val)
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = valueToAMQP(item)
+		}
+		return out
+	}
+	return v
+}
+
+// tableFromAMQP converts an amqp.Table, including nested tables, into a Table.
+func tableFromAMQP(t amqp.Table) Table {
+	if t == nil {
+		return nil
+	}
+	out := make(Table, len(t))
+	for k, v := range t {
+		out[k] = valueFromAMQP(v)
+	}
+	return out
+}
+
+func valueFromAMQP(v interface{}) interface{} {
+	switch val := v.(type) {
+	case amqp.Table:
+		return tableFromAMQP(val)
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = valueFromAMQP(item)
+		}
+		return out
+	}
+	return v
 }
@@ -0,0 +1,127 @@
+package rabbitmq
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAMQPChannel mimics how amqp delivers to consumers and notifies cancels.
+type fakeAMQPChannel struct {
+	amqpChannel
+
+	mu        sync.Mutex
+	consumers map[string]chan amqp.Delivery
+	cancels   []chan string
+}
+
+func (f *fakeAMQPChannel) Consume(_, consumer string, _, _, _, _ bool, _ amqp.Table) (<-chan amqp.Delivery, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.consumers == nil {
+		f.consumers = make(map[string]chan amqp.Delivery)
+	}
+	deliveries := make(chan amqp.Delivery)
+	f.consumers[consumer] = deliveries
+	return deliveries, nil
+}
+
+func (f *fakeAMQPChannel) NotifyCancel(c chan string) chan string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cancels = append(f.cancels, c)
+	return c
+}
+
+func (f *fakeAMQPChannel) NotifyClose(c chan *amqp.Error) chan *amqp.Error { return c }
+
+func (f *fakeAMQPChannel) Cancel(consumer string, _ bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	close(f.consumers[consumer])
+	delete(f.consumers, consumer)
+	return nil
+}
+
+// brokerCancel closes the consumer's deliveries and notifies every listener,
+// blocking like amqp does until each has taken the tag.
+func (f *fakeAMQPChannel) brokerCancel(t *testing.T, consumer string) {
+	require.NoError(t, f.Cancel(consumer, false))
+	f.mu.Lock()
+	cancels := append([]chan string(nil), f.cancels...)
+	f.mu.Unlock()
+	for _, c := range cancels {
+		select {
+		case c <- consumer:
+		case <-time.After(time.Second):
+			t.Fatal("cancel notification was not read")
+		}
+	}
+}
+
+func (f *fakeAMQPChannel) deliver(t *testing.T, consumer, body string) {
+	f.mu.Lock()
+	deliveries := f.consumers[consumer]
+	f.mu.Unlock()
+	select {
+	case deliveries <- amqp.Delivery{ConsumerTag: consumer, Body: []byte(body)}:
+	case <-time.After(time.Second):
+		t.Fatalf("delivery to %s was not read", consumer)
+	}
+}
+
+func TestAMQPChannelWrapper_BrokerCancelStopsOnlyItsConsumer(t *testing.T) {
+	raw := &fakeAMQPChannel{}
+	ch := WrapAMQPChannel(nil)
+	ch.(*amqpChannelWrapper).raw = raw
+
+	first, err := ch.Consume("orders", "first", false, false, false, false, nil)
+	require.NoError(t, err)
+	second, err := ch.Consume("payments", "second", false, false, false, false, nil)
+	require.NoError(t, err)
+
+	raw.brokerCancel(t, "first")
+	_, open := <-first
+	require.False(t, open)
+
+	raw.deliver(t, "second", "paid")
+	require.Equal(t, "paid", string((<-second).Body))
+
+	third, err := ch.Consume("refunds", "third", false, false, false, false, nil)
+	require.NoError(t, err)
+	raw.brokerCancel(t, "third")
+	_, open = <-third
+	require.False(t, open)
+
+	raw.deliver(t, "second", "shipped")
+	require.Equal(t, "shipped", string((<-second).Body))
+}
+
+func TestAMQPChannelWrapper_CancelUnblocksForwarding(t *testing.T) {
+	raw := &fakeAMQPChannel{}
+	ch := WrapAMQPChannel(nil)
+	ch.(*amqpChannelWrapper).raw = raw
+
+	msgs, err := ch.Consume("orders", "", false, false, false, false, nil)
+	require.NoError(t, err)
+	raw.mu.Lock()
+	var tag string
+	for tag = range raw.consumers {
+	}
+	raw.mu.Unlock()
+	require.NotEmpty(t, tag, "a tag is generated for the consumer")
+
+	// Nobody reads msgs, so forwarding blocks until the consumer is cancelled.
+	raw.deliver(t, tag, "unread")
+	require.NoError(t, ch.Cancel(tag, false))
+
+	select {
+	case _, open := <-msgs:
+		require.False(t, open)
+	case <-time.After(time.Second):
+		t.Fatal("deliveries were not closed")
+	}
+}
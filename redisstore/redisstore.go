@@ -2,23 +2,56 @@ package redisstore
 
 import (
 	"context"
+	"log/slog"
 	"time"
 )
 
 type Store struct {
 	client Client
+	logger *slog.Logger
 }
 
-func New(client Client) *Store {
-	return &Store{client: client}
+// Option configures a Store.
+type Option func(*Store)
+
+// WithLogger sets the logger the Store reports failed operations to at error
+// level and successful ones at debug level. Defaults to slog.Default().
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Store) {
+		if logger != nil {
+			s.logger = logger
+		}
+	}
+}
+
+func New(client Client, opts ...Option) *Store {
+	s := &Store{client: client, logger: slog.Default()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // Get returns the string value for the given key.
 func (s *Store) Get(ctx context.Context, key string) (string, error) {
-	return s.client.Get(ctx, key)
+	val, err := s.client.Get(ctx, key)
+	s.log(ctx, "get", key, err)
+	return val, err
 }
 
 // Set stores a string value with a TTL.
 func (s *Store) Set(ctx context.Context, key string, value string, ttl time.Duration) error {
-	return s.client.Set(ctx, key, value, ttl)
+	err := s.client.Set(ctx, key, value, ttl)
+	s.log(ctx, "set", key, err, slog.Duration("ttl", ttl))
+	return err
+}
+
+// log records the outcome of the operation op on key.
+func (s *Store) log(ctx context.Context, op, key string, err error, attrs ...slog.Attr) {
+	attrs = append(attrs, slog.String("op", op), slog.String("key", key))
+	if err != nil {
+		s.logger.LogAttrs(ctx, slog.LevelError, "redis operation failed", append(attrs, slog.Any("error", err))...)
+		return
+	}
+	s.logger.LogAttrs(ctx, slog.LevelDebug, "redis operation", attrs...)
 }
@@ -1,7 +1,10 @@
 package redisstore_test
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"log/slog"
 	"testing"
 	"time"
 
@@ -24,3 +27,25 @@ func TestStore_SetAndGet(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, value, got)
 }
+
+type failingClient struct{ err error }
+
+func (f failingClient) Get(context.Context, string) (string, error) { return "", f.err }
+
+func (f failingClient) Set(context.Context, string, string, time.Duration) error { return f.err }
+
+func TestStore_LogsFailures(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	store := redisstore.New(failingClient{err: errors.New("connection refused")}, redisstore.WithLogger(logger))
+
+	err := store.Set(context.Background(), "session:1", "v", time.Minute)
+	require.Error(t, err)
+	require.Contains(t, buf.String(), `level=ERROR msg="redis operation failed" ttl=1m0s op=set key=session:1 error="connection refused"`)
+
+	buf.Reset()
+	store = redisstore.New(redisstore.NewMockClient(), redisstore.WithLogger(logger))
+	_, err = store.Get(context.Background(), "session:1")
+	require.NoError(t, err)
+	require.Empty(t, buf.String(), "successful operations are logged at debug level")
+}